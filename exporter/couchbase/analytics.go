@@ -0,0 +1,248 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// per link from CBEMXENDPOINT_AnalyticsLinks
+type cbemxAnalyticsLinkDetails struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Scope      string `json:"scope"`
+	Encryption string `json:"encryption"`
+}
+
+// Links before 7.0 belong to a dataverse, which became the analytics scope
+func decodeDataverseLinks(body []byte, v interface{}) error {
+	links, ok := v.(*[]cbemxAnalyticsLinkDetails)
+	if !ok {
+		return fmt.Errorf("cannot decode analytics links into %T", v)
+	}
+	var dataverseLinks []struct {
+		cbemxAnalyticsLinkDetails
+		Dataverse string `json:"dataverse"`
+	}
+	if err := json.Unmarshal(body, &dataverseLinks); err != nil {
+		return err
+	}
+	for _, link := range dataverseLinks {
+		link.Scope = link.Dataverse
+		*links = append(*links, link.cbemxAnalyticsLinkDetails)
+	}
+	return nil
+}
+
+// CBEMXENDPOINT_AnalyticsIngestion
+type cbemxAnalyticsIngestionDetails struct {
+	Links []struct {
+		Name   string `json:"name"`
+		Scope  string `json:"scope"`
+		Status string `json:"status"`
+		State  []struct {
+			Progress float64 `json:"progress"`
+			TimeLag  float64 `json:"timeLag"`
+		} `json:"state"`
+	} `json:"links"`
+}
+
+// CBEMXENDPOINT_AnalyticsQuery
+type cbemxAnalyticsQueryDetails struct {
+	Results []float64 `json:"results"`
+}
+
+// CBEMXENDPOINT_AnalyticsSettings
+type cbemxAnalyticsSettingsDetails struct {
+	NumReplicas int `json:"numReplicas"`
+}
+
+// Metadata queries for the dataverse and dataset counts, run on the analytics service
+const ANALYTICS_DATAVERSE_COUNT = "SELECT VALUE COUNT(*) FROM Metadata.`Dataverse` WHERE DataverseName != 'Metadata'"
+const ANALYTICS_DATASET_COUNT = "SELECT VALUE COUNT(*) FROM Metadata.`Dataset` WHERE DataverseName != 'Metadata'"
+
+// Label options for radio select metric streams
+var ANALYTICS_LINK_TYPES = [...]string{"couchbase", "s3", "azureblob", "gcs"}
+var ANALYTICS_LINK_ENCRYPTION = [...]string{"none", "half", "full"}
+var ANALYTICS_INGESTION_STATUS = [...]string{"healthy", "unhealthy", "suspended", "stopped"}
+
+// Analytics links, datasets, ingestion and service configuration
+type analyticsCollector struct {
+	analytics_link_count            *prometheus.Desc
+	analytics_link_encryption       *prometheus.Desc
+	analytics_dataverse_count       *prometheus.Desc
+	analytics_dataset_count         *prometheus.Desc
+	analytics_ingestion_status      *prometheus.Desc
+	analytics_ingestion_progress    *prometheus.Desc
+	analytics_ingestion_time_lag_ms *prometheus.Desc
+	analytics_replica_count         *prometheus.Desc
+	analytics_service_setting       *prometheus.Desc
+}
+
+func init() {
+	registerCollector("analytics", true, newAnalyticsCollector)
+}
+
+func newAnalyticsCollector() subCollector {
+	var linkLabels = []string{"cluster_uuid", "link", "scope"}
+	return &analyticsCollector{
+		analytics_link_count: newEmxDesc("analytics_link_count",
+			"The number of analytics links by type.",
+			[]string{"cluster_uuid", "type"},
+		),
+		analytics_link_encryption: newEmxDesc("analytics_link_encryption",
+			"Remote couchbase link encryption {none/half/full} selected state(1 - selected).",
+			append(linkLabels, "encryption"),
+		),
+		analytics_dataverse_count: newEmxDesc("analytics_dataverse_count",
+			"The number of analytics dataverses (scopes).",
+			[]string{"cluster_uuid"},
+		),
+		analytics_dataset_count: newEmxDesc("analytics_dataset_count",
+			"The number of analytics datasets (collections).",
+			[]string{"cluster_uuid"},
+		),
+		analytics_ingestion_status: newEmxDesc("analytics_ingestion_status",
+			"Link ingestion status {healthy/unhealthy/suspended/stopped} selected state(1 - selected).",
+			append(linkLabels, "status"),
+		),
+		analytics_ingestion_progress: newEmxDesc("analytics_ingestion_progress",
+			"The lowest ingestion progress of the link between 0 and 1.",
+			linkLabels,
+		),
+		analytics_ingestion_time_lag_ms: newEmxDesc("analytics_ingestion_time_lag_ms",
+			"The largest ingestion time lag of the link in ms.",
+			linkLabels,
+		),
+		analytics_replica_count: newEmxDesc("analytics_replica_count",
+			"The number of analytics replicas.",
+			[]string{"cluster_uuid"},
+		),
+		analytics_service_setting: newEmxDesc("analytics_service_setting",
+			"The value of a numeric analytics service setting.",
+			[]string{"cluster_uuid", "setting"},
+		),
+	}
+}
+
+func (collector *analyticsCollector) Name() string {
+	return "analytics"
+}
+
+func (collector *analyticsCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus, CBEMXENDPOINT_AnalyticsSettings, ":8095" + CBEMXENDPOINT_AnalyticsLinks, ":8095" + CBEMXENDPOINT_AnalyticsConfig, ":8095" + CBEMXENDPOINT_AnalyticsIngestion, ":8095" + CBEMXENDPOINT_AnalyticsQuery + "<metadata query>"}
+}
+
+func (collector *analyticsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.analytics_link_count
+	ch <- collector.analytics_link_encryption
+	ch <- collector.analytics_dataverse_count
+	ch <- collector.analytics_dataset_count
+	ch <- collector.analytics_ingestion_status
+	ch <- collector.analytics_ingestion_progress
+	ch <- collector.analytics_ingestion_time_lag_ms
+	ch <- collector.analytics_replica_count
+	ch <- collector.analytics_service_setting
+}
+
+func (collector *analyticsCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                          []error
+		cbemxAnalyticsLinksArray      []cbemxAnalyticsLinkDetails
+		cbemxAnalyticsIngestionStruct cbemxAnalyticsIngestionDetails
+		cbemxAnalyticsSettingsStruct  cbemxAnalyticsSettingsDetails
+		analyticsConfig               map[string]interface{}
+	)
+	var analyticsNodes = s.serviceNodes("cbas")
+	if len(analyticsNodes) == 0 {
+		return nil
+	}
+
+	// no links REST API before 6.6
+	if !s.available("analytics_links") {
+		level.Info(logger).Log("Event", "No analytics links at cluster version "+s.effectiveVersion().String())
+	} else if err := s.getVersioned("analytics_links", &cbemxAnalyticsLinksArray); err != nil {
+		errs = append(errs, err)
+	} else {
+		var linkCounts = make(map[string]int)
+		for _, link := range cbemxAnalyticsLinksArray {
+			linkCounts[link.Type]++
+			if link.Type != "couchbase" {
+				continue
+			}
+			for _, option := range ANALYTICS_LINK_ENCRYPTION {
+				ch <- prometheus.MustNewConstMetric(collector.analytics_link_encryption, prometheus.GaugeValue, float64(boolVal(option == link.Encryption)), s.uuid, link.Name, link.Scope, option)
+			}
+		}
+		for _, option := range ANALYTICS_LINK_TYPES {
+			ch <- prometheus.MustNewConstMetric(collector.analytics_link_count, prometheus.GaugeValue, float64(linkCounts[option]), s.uuid, option)
+		}
+	}
+
+	for _, count := range []struct {
+		desc      *prometheus.Desc
+		statement string
+	}{
+		{collector.analytics_dataverse_count, ANALYTICS_DATAVERSE_COUNT},
+		{collector.analytics_dataset_count, ANALYTICS_DATASET_COUNT},
+	} {
+		var cbemxAnalyticsQueryStruct cbemxAnalyticsQueryDetails
+		if err := s.getAnyService(analyticsNodes, "cbas", CBEMXENDPOINT_AnalyticsQuery+url.QueryEscape(count.statement), &cbemxAnalyticsQueryStruct); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(cbemxAnalyticsQueryStruct.Results) == 1 {
+			ch <- prometheus.MustNewConstMetric(count.desc, prometheus.GaugeValue, cbemxAnalyticsQueryStruct.Results[0], s.uuid)
+		}
+	}
+
+	if err := s.getAnyService(analyticsNodes, "cbas", CBEMXENDPOINT_AnalyticsIngestion, &cbemxAnalyticsIngestionStruct); err != nil {
+		errs = append(errs, err)
+	}
+	for _, link := range cbemxAnalyticsIngestionStruct.Links {
+		var progress, timeLag float64 = 1, 0
+		for _, state := range link.State {
+			if state.Progress < progress {
+				progress = state.Progress
+			}
+			if state.TimeLag > timeLag {
+				timeLag = state.TimeLag
+			}
+		}
+		for _, option := range ANALYTICS_INGESTION_STATUS {
+			ch <- prometheus.MustNewConstMetric(collector.analytics_ingestion_status, prometheus.GaugeValue, float64(boolVal(option == link.Status)), s.uuid, link.Name, link.Scope, option)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.analytics_ingestion_progress, prometheus.GaugeValue, progress, s.uuid, link.Name, link.Scope)
+		ch <- prometheus.MustNewConstMetric(collector.analytics_ingestion_time_lag_ms, prometheus.GaugeValue, timeLag, s.uuid, link.Name, link.Scope)
+	}
+
+	// replicas are configured through the cluster manager, from 7.1
+	if s.has("analytics_replicas") {
+		if err := s.get(CBEMXENDPOINT_AnalyticsSettings, &cbemxAnalyticsSettingsStruct); err != nil {
+			errs = append(errs, err)
+		} else {
+			ch <- prometheus.MustNewConstMetric(collector.analytics_replica_count, prometheus.GaugeValue, float64(cbemxAnalyticsSettingsStruct.NumReplicas), s.uuid)
+		}
+	}
+
+	if err := s.getAnyService(analyticsNodes, "cbas", CBEMXENDPOINT_AnalyticsConfig, &analyticsConfig); err != nil {
+		errs = append(errs, err)
+	}
+	var settings []string
+	for setting, value := range analyticsConfig {
+		if _, ok := value.(float64); ok {
+			settings = append(settings, setting)
+		}
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		ch <- prometheus.MustNewConstMetric(collector.analytics_service_setting, prometheus.GaugeValue, analyticsConfig[setting].(float64), s.uuid, setting)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,147 @@
+package couchbase
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_AutoFailover
+type cbemxAutoFailoverDetails struct {
+	Enabled                  bool `json:"enabled"`
+	Timeout                  int  `json:"timeout"`
+	MaxCount                 int  `json:"maxCount"`
+	Count                    int  `json:"count"`
+	FailoverOnDataDiskIssues struct {
+		Enabled    bool `json:"enabled"`
+		TimePeriod int  `json:"timePeriod"`
+	} `json:"failoverOnDataDiskIssues"`
+}
+
+// Autofailover settings and failover counters
+type autofailoverCollector struct {
+	autofailover_enabled         *prometheus.Desc
+	autofailover_on_disk_enabled *prometheus.Desc
+	autofailover_on_disk_timeout *prometheus.Desc
+	autofailover_timeout         *prometheus.Desc
+	autofailover_max_count       *prometheus.Desc
+	autofailover_current_count   *prometheus.Desc
+	failover_counter             *prometheus.Desc
+	failover_start_counter       *prometheus.Desc
+	failover_complete_counter    *prometheus.Desc
+	failover_success_counter     *prometheus.Desc
+	failover_stop_counter        *prometheus.Desc
+	failover_fail_counter        *prometheus.Desc
+}
+
+func init() {
+	registerCollector("autofailover", true, newAutofailoverCollector)
+}
+
+func newAutofailoverCollector() subCollector {
+	return &autofailoverCollector{
+		autofailover_enabled: newEmxDesc("autofailover_enabled",
+			"The Autofailover state 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid"},
+		),
+		autofailover_timeout: newEmxDesc("autofailover_timeout",
+			"The Autofailover timeout in seconds.",
+			[]string{"cluster_uuid"},
+		),
+		autofailover_on_disk_enabled: newEmxDesc("autofailover_on_disk_enabled",
+			"The 'Autofailover On Disk Failures' state 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid"},
+		),
+		autofailover_on_disk_timeout: newEmxDesc("autofailover_on_disk_timeout",
+			"The 'Autofailover On Disk Failures' timeout in seconds",
+			[]string{"cluster_uuid"},
+		),
+		autofailover_max_count: newEmxDesc("autofailover_max_count",
+			"Maximum count for auto-failed servers.",
+			[]string{"cluster_uuid"},
+		),
+		autofailover_current_count: newEmxDesc("autofailover_current_count",
+			"Current count of auto-failed servers.",
+			[]string{"cluster_uuid"},
+		),
+		failover_counter: newEmxDesc("failover_counter",
+			"The number of failovers performed.",
+			[]string{"cluster_uuid"},
+		),
+		failover_start_counter: newEmxDesc("failover_start_counter",
+			"The total number of failovers started.",
+			[]string{"cluster_uuid"},
+		),
+		failover_complete_counter: newEmxDesc("failover_complete_counter",
+			"The total number of failovers completed.",
+			[]string{"cluster_uuid"},
+		),
+		failover_success_counter: newEmxDesc("failover_success_counter",
+			"The total number of failovers completed successfully.",
+			[]string{"cluster_uuid"},
+		),
+		failover_stop_counter: newEmxDesc("failover_stop_counter",
+			"The total number of failovers stopped before completion.",
+			[]string{"cluster_uuid"},
+		),
+		failover_fail_counter: newEmxDesc("failover_fail_counter",
+			"The total number of failovers that failed.",
+			[]string{"cluster_uuid"},
+		),
+	}
+}
+
+func (collector *autofailoverCollector) Name() string {
+	return "autofailover"
+}
+
+func (collector *autofailoverCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_AutoFailover, CBEMXENDPOINT_ClusterStatus}
+}
+
+func (collector *autofailoverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.autofailover_enabled
+	ch <- collector.autofailover_on_disk_enabled
+	ch <- collector.autofailover_on_disk_timeout
+	ch <- collector.autofailover_timeout
+	ch <- collector.autofailover_max_count
+	ch <- collector.autofailover_current_count
+	ch <- collector.failover_counter
+	ch <- collector.failover_start_counter
+	ch <- collector.failover_complete_counter
+	ch <- collector.failover_success_counter
+	ch <- collector.failover_stop_counter
+	ch <- collector.failover_fail_counter
+}
+
+func (collector *autofailoverCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		cbemxAutoFailoverStruct  cbemxAutoFailoverDetails
+		cbemxClusterStatusStruct cbemxClusterStatusDetails
+	)
+	if err := s.get(CBEMXENDPOINT_AutoFailover, &cbemxAutoFailoverStruct); err != nil {
+		return err
+	}
+
+	// Autofailover
+	ch <- prometheus.MustNewConstMetric(collector.autofailover_enabled, prometheus.GaugeValue, float64(boolVal(cbemxAutoFailoverStruct.Enabled)), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.autofailover_timeout, prometheus.GaugeValue, float64(cbemxAutoFailoverStruct.Timeout), s.uuid)
+	if s.has("failover_on_data_disk_issues") {
+		ch <- prometheus.MustNewConstMetric(collector.autofailover_on_disk_enabled, prometheus.GaugeValue, float64(boolVal(cbemxAutoFailoverStruct.FailoverOnDataDiskIssues.Enabled)), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.autofailover_on_disk_timeout, prometheus.GaugeValue, float64(cbemxAutoFailoverStruct.FailoverOnDataDiskIssues.TimePeriod), s.uuid)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.autofailover_max_count, prometheus.GaugeValue, float64(cbemxAutoFailoverStruct.MaxCount), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.autofailover_current_count, prometheus.CounterValue, float64(cbemxAutoFailoverStruct.Count), s.uuid)
+
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return err
+	}
+	counters := cbemxClusterStatusStruct.Counters
+
+	// Failovers
+	ch <- prometheus.MustNewConstMetric(collector.failover_counter, prometheus.CounterValue, float64(counters.Failover), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.failover_start_counter, prometheus.CounterValue, float64(counters.Failover_start), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.failover_complete_counter, prometheus.CounterValue, float64(counters.Failover_complete), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.failover_success_counter, prometheus.CounterValue, float64(counters.Failover_success), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.failover_stop_counter, prometheus.CounterValue, float64(counters.Failover_stop), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.failover_fail_counter, prometheus.CounterValue, float64(counters.Failover_fail), s.uuid)
+	return nil
+}
@@ -0,0 +1,212 @@
+package couchbase
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// per repository from CBEMXENDPOINT_BackupRepositories
+type cbemxBackupRepositoryDetails struct {
+	Id       string `json:"id"`
+	PlanName string `json:"plan_name"`
+	State    string `json:"state"`
+	Bucket   struct {
+		Name string `json:"name"`
+	} `json:"bucket"` // only set for bucket level repositories
+}
+
+// per task of a repository from the repository task history, newest first
+type cbemxBackupTaskHistoryDetails struct {
+	TaskName string `json:"task_name"`
+	Status   string `json:"status"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// per plan from CBEMXENDPOINT_BackupPlans
+type cbemxBackupPlanDetails struct {
+	Name     string   `json:"name"`
+	Services []string `json:"services"` // all services when empty
+	Tasks    []struct {
+		Name     string `json:"name"`
+		TaskType string `json:"task_type"`
+		Schedule struct {
+			Frequency float64 `json:"frequency"`
+			Period    string  `json:"period"`
+		} `json:"schedule"`
+	} `json:"tasks"`
+}
+
+// Seconds per schedule period, weekday periods run once a week
+var BACKUP_SCHEDULE_PERIODS = map[string]float64{
+	"MINUTES": 60, "HOURS": 3600, "DAYS": 86400, "WEEKS": 604800,
+	"MONDAY": 604800, "TUESDAY": 604800, "WEDNESDAY": 604800, "THURSDAY": 604800, "FRIDAY": 604800, "SATURDAY": 604800, "SUNDAY": 604800,
+}
+
+// Label options for radio select metric streams
+var BACKUP_TASK_STATUS = [...]string{"done", "failed", "running", "unknown"}
+
+// Backup service repositories and plans, and backup coverage of the buckets
+type backupCollector struct {
+	backup_repository_info                        *prometheus.Desc
+	backup_plan_task_interval_seconds             *prometheus.Desc
+	backup_repository_last_task_status            *prometheus.Desc
+	backup_repository_last_task_timestamp_seconds *prometheus.Desc
+	bucket_has_backup_plan                        *prometheus.Desc
+}
+
+func init() {
+	registerCollector("backup", true, newBackupCollector)
+}
+
+func newBackupCollector() subCollector {
+	return &backupCollector{
+		backup_repository_info: newEmxDesc("backup_repository_info",
+			"Active backup repository with its plan and bucket, empty for all buckets, always 1.",
+			[]string{"cluster_uuid", "repository", "plan", "bucket"},
+		),
+		backup_plan_task_interval_seconds: newEmxDesc("backup_plan_task_interval_seconds",
+			"The interval between scheduled runs of a backup plan task in seconds.",
+			[]string{"cluster_uuid", "plan", "task", "task_type"},
+		),
+		backup_repository_last_task_status: newEmxDesc("backup_repository_last_task_status",
+			"The status of the last task of a repository {done/failed/running/unknown} selected state(1 - selected).",
+			[]string{"cluster_uuid", "repository", "status"},
+		),
+		backup_repository_last_task_timestamp_seconds: newEmxDesc("backup_repository_last_task_timestamp_seconds",
+			"The end time of the last task of a repository, or its start time while running, in seconds since epoch.",
+			[]string{"cluster_uuid", "repository"},
+		),
+		bucket_has_backup_plan: newEmxDesc("bucket_has_backup_plan",
+			"The bucket is backed up by an active repository with a scheduled backup task 0/1 --> false/true.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+	}
+}
+
+func (collector *backupCollector) Name() string {
+	return "backup"
+}
+
+func (collector *backupCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus, CBEMXENDPOINT_BucketStats, ":8097" + CBEMXENDPOINT_BackupRepositories, ":8097" + CBEMXENDPOINT_BackupRepositories + "/<id>/taskHistory", ":8097" + CBEMXENDPOINT_BackupPlans}
+}
+
+func (collector *backupCollector) requiredCapability() string {
+	return "backup_service"
+}
+
+func (collector *backupCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.backup_repository_info
+	ch <- collector.backup_plan_task_interval_seconds
+	ch <- collector.backup_repository_last_task_status
+	ch <- collector.backup_repository_last_task_timestamp_seconds
+	ch <- collector.bucket_has_backup_plan
+}
+
+// Whether a plan takes scheduled backups of the data service
+func backsUpData(plan cbemxBackupPlanDetails) bool {
+	var dataIncluded = len(plan.Services) == 0
+	for _, service := range plan.Services {
+		dataIncluded = dataIncluded || service == "data"
+	}
+	for _, task := range plan.Tasks {
+		if dataIncluded && task.TaskType == "BACKUP" {
+			return true
+		}
+	}
+	return false
+}
+
+func (collector *backupCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                         []error
+		cbemxBackupRepositoriesArray []cbemxBackupRepositoryDetails
+		cbemxBackupPlansArray        []cbemxBackupPlanDetails
+		cbemxBucketStatsStructArray  cbemxBucketStatsArray
+	)
+	var backupNodes = s.serviceNodes("backup")
+	if len(backupNodes) == 0 {
+		return nil
+	}
+
+	// without the plans the coverage of the buckets is unknown rather than none
+	var plans = make(map[string]cbemxBackupPlanDetails)
+	var plansKnown = true
+	if err := s.getAnyService(backupNodes, "backup", CBEMXENDPOINT_BackupPlans, &cbemxBackupPlansArray); err != nil {
+		errs = append(errs, err)
+		plansKnown = false
+	}
+	for _, plan := range cbemxBackupPlansArray {
+		plans[plan.Name] = plan
+		for _, task := range plan.Tasks {
+			if period, ok := BACKUP_SCHEDULE_PERIODS[task.Schedule.Period]; ok {
+				ch <- prometheus.MustNewConstMetric(collector.backup_plan_task_interval_seconds, prometheus.GaugeValue, task.Schedule.Frequency*period, s.uuid, plan.Name, task.Name, task.TaskType)
+			}
+		}
+	}
+
+	if err := s.getAnyService(backupNodes, "backup", CBEMXENDPOINT_BackupRepositories, &cbemxBackupRepositoriesArray); err != nil {
+		errs = append(errs, err)
+		return errors.Join(errs...)
+	}
+	var (
+		allBuckets     bool
+		backedUpBucket = make(map[string]bool)
+	)
+	for _, repository := range cbemxBackupRepositoriesArray {
+		ch <- prometheus.MustNewConstMetric(collector.backup_repository_info, prometheus.GaugeValue, 1, s.uuid, repository.Id, repository.PlanName, repository.Bucket.Name)
+		if plansKnown && backsUpData(plans[repository.PlanName]) {
+			if repository.Bucket.Name == "" {
+				allBuckets = true
+			}
+			backedUpBucket[repository.Bucket.Name] = true
+		}
+
+		var cbemxBackupTaskHistoryArray []cbemxBackupTaskHistoryDetails
+		var taskHistory = CBEMXENDPOINT_BackupRepositories + "/" + url.PathEscape(repository.Id) + "/taskHistory?limit=1"
+		if err := s.getAnyService(backupNodes, "backup", taskHistory, &cbemxBackupTaskHistoryArray); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(cbemxBackupTaskHistoryArray) == 0 {
+			continue
+		}
+		var lastTask = cbemxBackupTaskHistoryArray[0]
+		var status = strings.ToLower(lastTask.Status)
+		if status != "done" && status != "failed" && status != "running" {
+			status = "unknown"
+		}
+		for _, option := range BACKUP_TASK_STATUS {
+			ch <- prometheus.MustNewConstMetric(collector.backup_repository_last_task_status, prometheus.GaugeValue, float64(boolVal(option == status)), s.uuid, repository.Id, option)
+		}
+		var lastTime = lastTask.End
+		if status == "running" || lastTime == "" {
+			lastTime = lastTask.Start
+		}
+		if timestamp, err := time.Parse(time.RFC3339, lastTime); err == nil {
+			ch <- prometheus.MustNewConstMetric(collector.backup_repository_last_task_timestamp_seconds, prometheus.GaugeValue, float64(timestamp.Unix()), s.uuid, repository.Id)
+		}
+	}
+
+	// cross reference with the buckets of the cluster
+	if !plansKnown {
+		return errors.Join(errs...)
+	}
+	if err := s.get(CBEMXENDPOINT_BucketStats, &cbemxBucketStatsStructArray.Buckets); err != nil {
+		errs = append(errs, err)
+		return errors.Join(errs...)
+	}
+	for _, bucket := range cbemxBucketStatsStructArray.Buckets {
+		if !s.include("bucket", bucket.BucketName) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.bucket_has_backup_plan, prometheus.GaugeValue, float64(boolVal(allBuckets || backedUpBucket[bucket.BucketName])), s.uuid, bucket.BucketName)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+package couchbase
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBackupPlansFailing(t *testing.T) {
+	replayFixtures(t, "backup_plans_failing")
+	collector := collectorRegistry["backup"].factory().(*backupCollector)
+
+	ch := make(chan prometheus.Metric, 100)
+	err := collector.Collect(newScrape(), ch)
+	close(ch)
+	if err == nil {
+		t.Error("no error without backup plans")
+	}
+	var repositories int
+	for metric := range ch {
+		switch metric.Desc() {
+		case collector.bucket_has_backup_plan:
+			t.Errorf("bucket_has_backup_plan reported without backup plans: %s", labelValuesKey(metric))
+		case collector.backup_repository_info:
+			repositories++
+		}
+	}
+	if repositories != 1 {
+		t.Errorf("%d backup_repository_info series, expected 1", repositories)
+	}
+}
@@ -0,0 +1,128 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_BucketStats
+type cbemxBucketStatsArray struct {
+	Buckets []cbemxBucketStatsDetails `json:"-"`
+}
+
+// Per bucket from CBEMXENDPOINT_BucketStats
+type cbemxBucketStatsDetails struct {
+	EvictionPolicy         string `json:"evictionPolicy"`
+	BucketName             string `json:"name"`
+	ConflictResolutionType string `json:"conflictResolutionType"`
+	StorageBackend         string `json:"storageBackend"`
+	CompressionMode        string `json:"compressionMode"`
+	VBucketServerMap       struct {
+		NumReplicas int `json:"numReplicas"`
+	} `json:"vBucketServerMap"`
+}
+
+// Label options for radio select metric streams
+var BUCKET_EVICTION_METHOD = [...]string{"valueOnly", "fullEviction", "noEviction", "nruEviction"}
+var BUCKET_COMPRESSION_METHOD = [...]string{"off", "passive", "active"}
+var BUCKET_STORAGE_BACKEND = [...]string{"couchstore", "magma", "undefined"}
+var BUCKET_CONFLICT_RESOLUTION = [...]string{"seqno", "lww", "custom"}
+
+// Buckets before 7.0, couchstore is the only storage backend
+func decodeBucketsWithoutStorageBackend(body []byte, v interface{}) error {
+	buckets, ok := v.(*[]cbemxBucketStatsDetails)
+	if !ok {
+		return fmt.Errorf("cannot decode buckets into %T", v)
+	}
+	if err := json.Unmarshal(body, buckets); err != nil {
+		return err
+	}
+	for i := range *buckets {
+		(*buckets)[i].StorageBackend = "couchstore"
+	}
+	return nil
+}
+
+// Per bucket settings
+type bucketsCollector struct {
+	bucket_replica_count       *prometheus.Desc
+	bucket_eviction_type       *prometheus.Desc
+	bucket_compression_type    *prometheus.Desc
+	bucket_storage_backend     *prometheus.Desc
+	bucket_conflict_resolution *prometheus.Desc
+}
+
+func init() {
+	registerCollector("buckets", true, newBucketsCollector)
+}
+
+func newBucketsCollector() subCollector {
+	return &bucketsCollector{
+		bucket_replica_count: newEmxDesc("bucket_replica_count",
+			"The total number of replicas for a bucket.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+		bucket_eviction_type: newEmxDesc("bucket_eviction_type",
+			"The bucket eviction type {valueOnly/fullEviction/noEviction/nruEviction} selected state(1 - selected).",
+			[]string{"cluster_uuid", "bucket", "eviction"},
+		),
+		bucket_compression_type: newEmxDesc("bucket_compression_type",
+			"The bucket compression type {off/passive/active} selected state(1 - selected).",
+			[]string{"cluster_uuid", "bucket", "compression"},
+		),
+		bucket_storage_backend: newEmxDesc("bucket_storage_backend",
+			"The bucket storage backend type {couchstore/magma/undefined} selected state(1 - selected).",
+			[]string{"cluster_uuid", "bucket", "storage_backend"},
+		),
+		bucket_conflict_resolution: newEmxDesc("bucket_conflict_resolution",
+			"The bucket conflict resolution {seqno/lww/custom} selected state(1 - selected).",
+			[]string{"cluster_uuid", "bucket", "conflict_resolution"},
+		),
+	}
+}
+
+func (collector *bucketsCollector) Name() string {
+	return "buckets"
+}
+
+func (collector *bucketsCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_BucketStats}
+}
+
+func (collector *bucketsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.bucket_replica_count
+	ch <- collector.bucket_eviction_type
+	ch <- collector.bucket_compression_type
+	ch <- collector.bucket_storage_backend
+	ch <- collector.bucket_conflict_resolution
+}
+
+func (collector *bucketsCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxBucketStatsStructArray cbemxBucketStatsArray
+	if err := s.getVersioned("buckets", &cbemxBucketStatsStructArray.Buckets); err != nil {
+		return err
+	}
+
+	// per bucket metrics
+	for _, bucket := range cbemxBucketStatsStructArray.Buckets {
+		if !s.include("bucket", bucket.BucketName) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.bucket_replica_count, prometheus.GaugeValue, float64(bucket.VBucketServerMap.NumReplicas), s.uuid, bucket.BucketName)
+		for _, ev := range BUCKET_EVICTION_METHOD {
+			ch <- prometheus.MustNewConstMetric(collector.bucket_eviction_type, prometheus.GaugeValue, float64(boolVal(ev == bucket.EvictionPolicy)), s.uuid, bucket.BucketName, ev)
+		}
+		for _, com := range BUCKET_COMPRESSION_METHOD {
+			ch <- prometheus.MustNewConstMetric(collector.bucket_compression_type, prometheus.GaugeValue, float64(boolVal(com == bucket.CompressionMode)), s.uuid, bucket.BucketName, com)
+		}
+		for _, sto := range BUCKET_STORAGE_BACKEND {
+			ch <- prometheus.MustNewConstMetric(collector.bucket_storage_backend, prometheus.GaugeValue, float64(boolVal(sto == bucket.StorageBackend)), s.uuid, bucket.BucketName, sto)
+		}
+		for _, con := range BUCKET_CONFLICT_RESOLUTION {
+			ch <- prometheus.MustNewConstMetric(collector.bucket_conflict_resolution, prometheus.GaugeValue, float64(boolVal(con == bucket.ConflictResolutionType)), s.uuid, bucket.BucketName, con)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+)
+
+// A server feature EMX relies on, available from a cluster version on
+type capability struct {
+	name  string
+	since clusterVersion
+}
+
+/*
+* Features that older clusters lack. Collectors check these before calling an
+* endpoint, see scrape.has, and VERSIONED_ENDPOINTS picks endpoints and decoders by them.
+ */
+var CAPABILITIES = [...]capability{
+	{"failover_on_data_disk_issues", clusterVersion{5, 5}}, // failoverOnDataDiskIssues in /settings/autoFailover
+	{"collections", clusterVersion{7, 0}},                  // scope and collection in /indexStatus
+	{"bucket_storage_backend", clusterVersion{7, 0}},       // storageBackend in /pools/default/buckets
+	{"backup_service", clusterVersion{7, 0}},               // backup REST API on port 8097
+	{"analytics_links", clusterVersion{6, 6}},              // /analytics/link with dataverses
+	{"analytics_scoped_links", clusterVersion{7, 0}},       // /analytics/link with scopes
+	{"rebalance_report_stages", clusterVersion{7, 0}},      // stageInfo in /logs/rebalanceReport
+	{"system_event_log", clusterVersion{7, 1}},             // /events
+	{"cluster_certificates", clusterVersion{7, 1}},         // /pools/default/certificates
+	{"analytics_replicas", clusterVersion{7, 1}},           // /settings/analytics
+}
+
+/*
+* Endpoint of a feature and the decoder of its response, used while the cluster has the
+* capability. Decoders turn the response of their versions into the struct collectors use.
+ */
+type versionedEndpoint struct {
+	capability string // empty for any version
+	service    string // empty for the cluster manager, otherwise see SERVICE_PORTS
+	path       string
+	decode     func(body []byte, v interface{}) error // nil to unmarshal as is
+}
+
+/*
+* Endpoints per feature, newest first, see scrape.getVersioned.
+ */
+var VERSIONED_ENDPOINTS = map[string][]versionedEndpoint{
+	"index_status": {
+		{capability: "collections", path: CBEMXENDPOINT_IndexStatus},
+		{path: CBEMXENDPOINT_IndexStatus, decode: decodeIndexStatusWithoutCollections},
+	},
+	"buckets": {
+		{capability: "bucket_storage_backend", path: CBEMXENDPOINT_BucketStats},
+		{path: CBEMXENDPOINT_BucketStats, decode: decodeBucketsWithoutStorageBackend},
+	},
+	"analytics_links": {
+		{capability: "analytics_scoped_links", service: "cbas", path: CBEMXENDPOINT_AnalyticsLinks},
+		{capability: "analytics_links", service: "cbas", path: CBEMXENDPOINT_AnalyticsLinks, decode: decodeDataverseLinks},
+	},
+	"cluster_events": {
+		{capability: "system_event_log", path: CBEMXENDPOINT_Events, decode: decodeSystemEvents},
+		{path: CBEMXENDPOINT_Logs, decode: decodeUILog},
+	},
+}
+
+// Whether the cluster serves any endpoint of a feature
+func (s *scrape) available(feature string) bool {
+	for _, endpoint := range VERSIONED_ENDPOINTS[feature] {
+		if endpoint.capability == "" || s.has(endpoint.capability) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* Populate v from the newest endpoint of a feature the cluster has the capability for.
+* Older endpoints are tried when a request fails, clusters keep serving them after an upgrade.
+ */
+func (s *scrape) getVersioned(feature string, v interface{}) error {
+	var (
+		errs  []error
+		tried = make(map[string]bool)
+	)
+	for _, endpoint := range VERSIONED_ENDPOINTS[feature] {
+		if endpoint.capability != "" && !s.has(endpoint.capability) {
+			continue
+		}
+		// the same path answers the same way, whatever the decoder
+		if tried[endpoint.service+endpoint.path] {
+			continue
+		}
+		tried[endpoint.service+endpoint.path] = true
+		if len(errs) > 0 {
+			level.Info(logger).Log("Event", "Falling back to "+endpoint.path+" for "+feature+": "+errs[len(errs)-1].Error())
+		}
+
+		var body json.RawMessage
+		var err error
+		if endpoint.service == "" {
+			err = s.get(endpoint.path, &body)
+		} else {
+			err = s.getAnyService(s.serviceNodes(endpoint.service), endpoint.service, endpoint.path, &body)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if endpoint.decode == nil {
+			return json.Unmarshal(body, v)
+		}
+		return endpoint.decode(body, v)
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no endpoint for %s at cluster version %s", feature, s.effectiveVersion())
+	}
+	return errors.Join(errs...)
+}
+
+/*
+* Optionally implemented by sub-collectors that need a capability as a whole,
+* they are skipped while the cluster lacks it, e.g. during an upgrade.
+ */
+type capabilityCollector interface {
+	requiredCapability() string
+}
+
+// Version of a server build, "7.2.0-5325-enterprise" -> 7.2, zero when unparsable
+func parseVersion(version string) clusterVersion {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return clusterVersion{}
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return clusterVersion{}
+	}
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return clusterVersion{}
+	}
+	return clusterVersion{major: major, minor: minor}
+}
+
+/*
+* Version capabilities are decided on: the cluster compatibility, which stays at the
+* oldest version during a rolling upgrade, or the version of the node answering /pools.
+ */
+func (s *scrape) effectiveVersion() clusterVersion {
+	if s.compatibility != (clusterVersion{}) {
+		return s.compatibility
+	}
+	return s.version
+}
+
+// Whether the cluster has a capability, unknown versions and names are assumed capable
+func (s *scrape) has(name string) bool {
+	for _, c := range CAPABILITIES {
+		if c.name == name {
+			return s.supports(c.since)
+		}
+	}
+	return true
+}
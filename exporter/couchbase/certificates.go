@@ -0,0 +1,180 @@
+package couchbase
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Server certificate of the EMX HTTPS endpoint, empty when TLS is disabled
+var serverCertificatePath = ""
+
+// Set the EMX server certificate to report in the certificates collector
+func SetServerCertificate(path string) {
+	serverCertificatePath = path
+}
+
+// Per node from CBEMXENDPOINT_Certificates, also the response of CBEMXENDPOINT_NodeCertificate
+type cbemxNodeCertificateDetails struct {
+	Node    string `json:"node"`
+	Subject string `json:"subject"`
+	Expires string `json:"expires"`
+	Type    string `json:"type"`
+	Pem     string `json:"pem"`
+}
+
+// Per CA from CBEMXENDPOINT_TrustedCAs
+type cbemxTrustedCADetails struct {
+	Subject  string `json:"subject"`
+	NotAfter string `json:"notAfter"`
+	Type     string `json:"type"`
+	Pem      string `json:"pem"`
+}
+
+// Certificate inventory and expiry
+type certificatesCollector struct {
+	cert_expiry_timestamp_seconds *prometheus.Desc
+	cert_trusted_ca_count         *prometheus.Desc
+	cert_node_self_signed         *prometheus.Desc
+}
+
+func init() {
+	registerCollector("certificates", true, newCertificatesCollector)
+}
+
+func newCertificatesCollector() subCollector {
+	return &certificatesCollector{
+		cert_expiry_timestamp_seconds: newEmxDesc("cert_expiry_timestamp_seconds",
+			"The expiry time of a certificate {node/ca/emx_client/emx_server} as unix timestamp.",
+			[]string{"cluster_uuid", "node", "type", "subject"},
+		),
+		cert_trusted_ca_count: newEmxDesc("cert_trusted_ca_count",
+			"The number of trusted CA certificates.",
+			[]string{"cluster_uuid"},
+		),
+		cert_node_self_signed: newEmxDesc("cert_node_self_signed",
+			"The node uses the self-signed default certificate 0/1 --> false/true.",
+			[]string{"cluster_uuid", "node"},
+		),
+	}
+}
+
+func (collector *certificatesCollector) Name() string {
+	return "certificates"
+}
+
+func (collector *certificatesCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_Certificates, CBEMXENDPOINT_TrustedCAs, CBEMXENDPOINT_NodeCertificate + "<node>"}
+}
+
+func (collector *certificatesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.cert_expiry_timestamp_seconds
+	ch <- collector.cert_trusted_ca_count
+	ch <- collector.cert_node_self_signed
+}
+
+/*
+* Expiry of a certificate from the timestamp reported by the cluster,
+* falling back to the PEM when the timestamp is missing or unparsable.
+ */
+func certificateExpiry(timestamp string, pemData string) (time.Time, bool) {
+	if expiry, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return expiry, true
+	}
+	if block, _ := pem.Decode([]byte(pemData)); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			return cert.NotAfter, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (collector *certificatesCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                   []error
+		cbemxCertificatesArray []cbemxNodeCertificateDetails
+		cbemxTrustedCAsArray   []cbemxTrustedCADetails
+	)
+
+	// node certificates, one request per node before 7.1
+	var err = fmt.Errorf("no cluster wide certificate info at cluster version %s", s.effectiveVersion())
+	if s.has("cluster_certificates") {
+		err = s.get(CBEMXENDPOINT_Certificates, &cbemxCertificatesArray)
+	}
+	if err != nil {
+		level.Info(logger).Log("Event", "Falling back to per node certificate info: "+err.Error())
+		cbemxCertificatesArray = nil
+		var cbemxClusterStatusStruct cbemxClusterStatusDetails
+		if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+			errs = append(errs, err)
+		}
+		for _, node := range cbemxClusterStatusStruct.Nodes {
+			var nodeCertificate cbemxNodeCertificateDetails
+			if err := s.get(CBEMXENDPOINT_NodeCertificate+node.Hostname, &nodeCertificate); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			nodeCertificate.Node = node.Hostname
+			cbemxCertificatesArray = append(cbemxCertificatesArray, nodeCertificate)
+		}
+	}
+	for _, cert := range cbemxCertificatesArray {
+		var hostname = strings.Split(cert.Node, ":")[0]
+		ch <- prometheus.MustNewConstMetric(collector.cert_node_self_signed, prometheus.GaugeValue, float64(boolVal(cert.Type == "generated")), s.uuid, hostname)
+		if expiry, ok := certificateExpiry(cert.Expires, cert.Pem); ok {
+			ch <- prometheus.MustNewConstMetric(collector.cert_expiry_timestamp_seconds, prometheus.GaugeValue, float64(expiry.Unix()), s.uuid, hostname, "node", cert.Subject)
+		}
+	}
+
+	if err := s.get(CBEMXENDPOINT_TrustedCAs, &cbemxTrustedCAsArray); err != nil {
+		errs = append(errs, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.cert_trusted_ca_count, prometheus.GaugeValue, float64(len(cbemxTrustedCAsArray)), s.uuid)
+		// CAs sharing a subject (e.g. a renewed CA next to the old one) are one series, the first to expire
+		var (
+			subjects []string
+			expiries = make(map[string]time.Time)
+		)
+		for _, ca := range cbemxTrustedCAsArray {
+			expiry, ok := certificateExpiry(ca.NotAfter, ca.Pem)
+			if !ok {
+				continue
+			}
+			if earliest, seen := expiries[ca.Subject]; !seen {
+				subjects = append(subjects, ca.Subject)
+			} else if !expiry.Before(earliest) {
+				continue
+			}
+			expiries[ca.Subject] = expiry
+		}
+		for _, subject := range subjects {
+			ch <- prometheus.MustNewConstMetric(collector.cert_expiry_timestamp_seconds, prometheus.GaugeValue, float64(expiries[subject].Unix()), s.uuid, "", "ca", subject)
+		}
+	}
+
+	// certificates of the exporter itself
+	if len(X509KeyPair.Certificate) > 0 {
+		if cert, err := x509.ParseCertificate(X509KeyPair.Certificate[0]); err == nil {
+			ch <- prometheus.MustNewConstMetric(collector.cert_expiry_timestamp_seconds, prometheus.GaugeValue, float64(cert.NotAfter.Unix()), s.uuid, "", "emx_client", cert.Subject.String())
+		}
+	}
+	if serverCertificatePath != "" {
+		pemData, err := ioutil.ReadFile(serverCertificatePath)
+		if err != nil {
+			errs = append(errs, err)
+		} else if block, _ := pem.Decode(pemData); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				ch <- prometheus.MustNewConstMetric(collector.cert_expiry_timestamp_seconds, prometheus.GaugeValue, float64(cert.NotAfter.Unix()), s.uuid, "", "emx_server", cert.Subject.String())
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
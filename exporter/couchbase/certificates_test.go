@@ -0,0 +1,26 @@
+package couchbase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTrustedCAsSharingSubject(t *testing.T) {
+	collector := newReplayCollector(t, "certificates", "certificates")
+
+	expected := `
+# HELP cert_expiry_timestamp_seconds The expiry time of a certificate {node/ca/emx_client/emx_server} as unix timestamp.
+# TYPE cert_expiry_timestamp_seconds gauge
+cert_expiry_timestamp_seconds{cluster_uuid="00000000000000000000000000000001",node="host-1",subject="CN=host-1",type="node"} 1.811808e+09
+cert_expiry_timestamp_seconds{cluster_uuid="00000000000000000000000000000001",node="",subject="CN=Couchbase Server CA",type="ca"} 1.7960832e+09
+cert_expiry_timestamp_seconds{cluster_uuid="00000000000000000000000000000001",node="",subject="CN=Couchbase Root CA",type="ca"} 1.893456e+09
+# HELP cert_trusted_ca_count The number of trusted CA certificates.
+# TYPE cert_trusted_ca_count gauge
+cert_trusted_ca_count{cluster_uuid="00000000000000000000000000000001"} 3
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "cert_expiry_timestamp_seconds", "cert_trusted_ca_count"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,105 @@
+package couchbase
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_ClusterStatus
+type cbemxClusterStatusDetails struct {
+	Nodes            []cbemxNodeDetails `json:"nodes"`
+	Balanced         bool               `json:"balanced"`
+	MemoryQuota      int                `json:"memoryQuota"`
+	IndexMemoryQuota int                `json:"indexMemoryQuota"`
+	StorageTotals    struct {
+		Ram struct {
+			QuotaUsed int `json:"quotaUsed"`
+		} `json:"ram"`
+	} `json:"storageTotals"`
+	Counters struct {
+		Failover          int `json:"failover"`
+		Failover_start    int `json:"failover_start"`
+		Failover_complete int `json:"failover_complete"`
+		Failover_success  int `json:"failover_success"`
+		Failover_stop     int `json:"failover_stop"`
+		Failover_fail     int `json:"failover_fail"`
+		Rebalance_start   int `json:"rebalance_start"`
+		Rebalance_success int `json:"rebalance_success"`
+		Rebalance_fail    int `json:"rebalance_fail"`
+		Rebalance_stop    int `json:"rebalance_stop"`
+	}
+	//Nodes []map[string]interface{} `json:"nodes"` // strictly for counting number of nodes for alerting
+}
+
+// per node from CBEMXENDPOINT_ClusterStatus
+type cbemxNodeDetails struct {
+	Hostname    string   `json:"hostname"`
+	Services    []string `json:"services"`
+	MemoryTotal float64  `json:"memoryTotal"` // bytes
+}
+
+// CBEMXENDPOINT_ClusterUUID
+type cbemxClusterUUIDDetails struct {
+	UUID                  string `json:"uuid"`
+	ImplementationVersion string `json:"implementationVersion"`
+}
+
+// Cluster balance and memory quotas
+type clusterCollector struct {
+	cluster_balanced   *prometheus.Desc
+	data_memory_quota  *prometheus.Desc
+	index_memory_quota *prometheus.Desc
+	ram_quota_used     *prometheus.Desc
+}
+
+func init() {
+	registerCollector("cluster", true, newClusterCollector)
+}
+
+func newClusterCollector() subCollector {
+	return &clusterCollector{
+		cluster_balanced: newEmxDesc("cluster_balanced",
+			"Cluster balance state 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		data_memory_quota: newEmxDesc("data_memory_quota",
+			"The Data service memory quota in MB.",
+			[]string{"cluster_uuid"},
+		),
+		index_memory_quota: newEmxDesc("index_memory_quota",
+			"The Index service memory quota in MB.",
+			[]string{"cluster_uuid"},
+		),
+		ram_quota_used: newEmxDesc("ram_quota_used",
+			"Total RAM quota used in bytes.",
+			[]string{"cluster_uuid"},
+		),
+	}
+}
+
+func (collector *clusterCollector) Name() string {
+	return "cluster"
+}
+
+func (collector *clusterCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus}
+}
+
+func (collector *clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.cluster_balanced
+	ch <- collector.data_memory_quota
+	ch <- collector.index_memory_quota
+	ch <- collector.ram_quota_used
+}
+
+func (collector *clusterCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxClusterStatusStruct cbemxClusterStatusDetails
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(collector.cluster_balanced, prometheus.GaugeValue, float64(boolVal(cbemxClusterStatusStruct.Balanced)), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.data_memory_quota, prometheus.GaugeValue, float64(cbemxClusterStatusStruct.MemoryQuota), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_memory_quota, prometheus.GaugeValue, float64(cbemxClusterStatusStruct.IndexMemoryQuota), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.ram_quota_used, prometheus.GaugeValue, float64(cbemxClusterStatusStruct.StorageTotals.Ram.QuotaUsed), s.uuid)
+	return nil
+}
@@ -0,0 +1,488 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+* A sub-collector exports the metrics of one domain (buckets, indexes, autofailover, ...).
+* Each domain lives in its own file and registers itself in init(), see buckets.go.
+ */
+type subCollector interface {
+	// Name used for the --collector.<name> and --no-collector.<name> flags
+	Name() string
+	// Couchbase endpoints the collector reads
+	Endpoints() []string
+	Describe(ch chan<- *prometheus.Desc)
+	Collect(s *scrape, ch chan<- prometheus.Metric) error
+}
+
+// Registered sub-collector with its enable/disable flags
+type collectorRegistration struct {
+	factory          func() subCollector
+	enabledByDefault bool
+	enabled          *bool
+	disabled         *bool
+	// defines the --collector.<name>.<option> flags of the collector, optional
+	options func()
+}
+
+// Registry of all sub-collectors by name
+var collectorRegistry = make(map[string]*collectorRegistration)
+
+// Register a sub-collector, called from init() of the collector file
+func registerCollector(name string, enabledByDefault bool, factory func() subCollector) {
+	collectorRegistry[name] = &collectorRegistration{
+		factory:          factory,
+		enabledByDefault: enabledByDefault,
+	}
+}
+
+/*
+* Register the --collector.<name>.<option> flags of a sub-collector, called from init()
+* after registerCollector. The flags are defined by RegisterCollectorFlags.
+ */
+func registerCollectorOptions(name string, options func()) {
+	collectorRegistry[name].options = options
+}
+
+// Sorted sub-collector names for stable flag and collection order
+func collectorNames() []string {
+	names := make([]string, 0, len(collectorRegistry))
+	for name := range collectorRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+* Define --collector.<name>, --no-collector.<name> and the collector options for every sub-collector.
+* Must be called before flag.Parse().
+ */
+func RegisterCollectorFlags() {
+	for _, name := range collectorNames() {
+		registration := collectorRegistry[name]
+		registration.enabled = flag.Bool("collector."+name, registration.enabledByDefault, "Enable the "+name+" collector")
+		registration.disabled = flag.Bool("no-collector."+name, false, "Disable the "+name+" collector")
+		if registration.options != nil {
+			registration.options()
+		}
+	}
+}
+
+// Instantiate the sub-collectors enabled by flags
+func enabledCollectors() []subCollector {
+	var collectors []subCollector
+	for _, name := range collectorNames() {
+		registration := collectorRegistry[name]
+		var enabled = registration.enabledByDefault
+		if registration.enabled != nil {
+			enabled = *registration.enabled && !*registration.disabled
+		}
+		if !enabled {
+			level.Info(logger).Log("Event", "Collector '"+name+"' disabled")
+			continue
+		}
+		c := registration.factory()
+		level.Info(logger).Log("Event", "Collector '"+name+"' enabled, endpoints "+strings.Join(c.Endpoints(), ","))
+		collectors = append(collectors, c)
+	}
+	return collectors
+}
+
+// Prefix for all metric names, e.g. couchbase_emx -> couchbase_emx_bucket_replica_count
+var metricNamespace = ""
+
+// User defined labels added to every series, e.g. cluster_name, environment, region
+var constLabels = prometheus.Labels{}
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+/*
+* Set the metric namespace and constant labels, must be called before the collector is created.
+* param: namespace {string} - metric name prefix, no prefix if empty
+* param: labels {string} - comma separated name=value pairs, e.g. "cluster_name=prod1,region=eu"
+ */
+func ConfigureMetrics(namespace string, labels string) error {
+	if namespace != "" && !labelNamePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid metric namespace '%s'", namespace)
+	}
+	metricNamespace = namespace
+	constLabels = prometheus.Labels{}
+	reserved := reservedLabelNames()
+	for _, pair := range strings.Split(labels, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid constant label '%s', expected name=value", pair)
+		}
+		// prometheus refuses to register metrics with the same label twice
+		if reserved[name] {
+			return fmt.Errorf("invalid constant label '%s', '%s' is already a label of EMX metrics", pair, name)
+		}
+		constLabels[name] = strings.TrimSpace(value)
+	}
+	level.Info(logger).Log("Event", "Metric namespace '"+metricNamespace+"', constant labels "+fmt.Sprint(constLabels))
+	return nil
+}
+
+// Label names used by any sub-collector, enabled or not, and by the exporter's own metrics
+func reservedLabelNames() map[string]bool {
+	reserved := map[string]bool{"cluster_uuid": true, "collector": true, "object_type": true, "family": true}
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		for _, name := range collectorNames() {
+			collectorRegistry[name].factory().Describe(ch)
+		}
+		close(ch)
+	}()
+	for desc := range ch {
+		for _, label := range lookupEmxDesc(desc).labels {
+			reserved[label] = true
+		}
+	}
+	return reserved
+}
+
+// Name and variable labels of a Desc created by newEmxDesc, prometheus.Desc does not expose them
+type emxDesc struct {
+	fqName string
+	labels []string
+}
+
+var (
+	emxDescsMu sync.Mutex
+	emxDescs   = make(map[*prometheus.Desc]emxDesc)
+)
+
+// Metric description for a sub-collector metric, with namespace and constant labels applied
+func newEmxDesc(name string, help string, labels []string) *prometheus.Desc {
+	fqName := prometheus.BuildFQName(metricNamespace, "", name)
+	desc := prometheus.NewDesc(fqName, help, labels, constLabels)
+	emxDescsMu.Lock()
+	emxDescs[desc] = emxDesc{fqName: fqName, labels: labels}
+	emxDescsMu.Unlock()
+	return desc
+}
+
+// Label values with one more value appended, always a new slice so series never share label storage
+func withLabel(labels []string, value string) []string {
+	return append(append(make([]string, 0, len(labels)+1), labels...), value)
+}
+
+// Name and variable labels recorded by newEmxDesc, empty for other Descs
+func lookupEmxDesc(desc *prometheus.Desc) emxDesc {
+	emxDescsMu.Lock()
+	defer emxDescsMu.Unlock()
+	return emxDescs[desc]
+}
+
+/*
+* Per scrape state shared between sub-collectors.
+* Endpoint responses are cached for the scrape so that an endpoint read by
+* several collectors (e.g. /pools/nodes) is only requested once.
+ */
+type scrape struct {
+	uuid string
+	// version of the node answering /pools and effective cluster compatibility, zero when unknown
+	version       clusterVersion
+	compatibility clusterVersion
+	mu            sync.Mutex
+	responses     map[string][]byte
+	errors        map[string]error
+	// names of objects excluded by filters per object type, for the running collector
+	filtered map[string]map[string]bool
+}
+
+func newScrape() *scrape {
+	s := &scrape{
+		responses: make(map[string][]byte),
+		errors:    make(map[string]error),
+	}
+	var cluster = detectCluster(s)
+	s.uuid = cluster.uuid
+	s.version = cluster.version
+	s.compatibility = cluster.compatibility
+	return s
+}
+
+// Populate cbemxStruct from the endpoint response, requesting it once per scrape
+func (s *scrape) get(apiEndpoint string, cbemxStruct interface{}) error {
+	return s.getUrl(CB_CONNECTIONSTRING+apiEndpoint, cbemxStruct)
+}
+
+/*
+* Populate cbemxStruct from a service endpoint of one node, e.g. the query service on port 8093.
+* param: hostname {string} - node hostname as listed in /pools/nodes, the management port is ignored
+* param: service {string} - service name as listed in /pools/nodes, see SERVICE_PORTS
+ */
+func (s *scrape) getService(hostname string, service string, apiEndpoint string, cbemxStruct interface{}) error {
+	serviceUrl, err := nodeServiceUrl(hostname, service)
+	if err != nil {
+		return err
+	}
+	return s.getUrl(serviceUrl+apiEndpoint, cbemxStruct)
+}
+
+/*
+* Populate cbemxStruct from the first of the given nodes that answers, for cluster wide
+* service endpoints that every node of the service can serve.
+ */
+func (s *scrape) getAnyService(hostnames []string, service string, apiEndpoint string, cbemxStruct interface{}) error {
+	var errs []error
+	for _, hostname := range hostnames {
+		err := s.getService(hostname, service, apiEndpoint, cbemxStruct)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no '%s' node to call %s on", service, apiEndpoint)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *scrape) getUrl(cbStatsApi string, cbemxStruct interface{}) error {
+	s.mu.Lock()
+	body, cached := s.responses[cbStatsApi]
+	err := s.errors[cbStatsApi]
+	var fetched = !cached && err == nil
+	if fetched {
+		level.Info(logger).Log("Event", "Collecting stats from CB "+strings.TrimPrefix(cbStatsApi, CB_CONNECTIONSTRING))
+		body, err = getCbemxBytes(cbStatsApi)
+		if err != nil {
+			s.errors[cbStatsApi] = err
+		} else {
+			s.responses[cbStatsApi] = body
+		}
+	}
+	s.mu.Unlock()
+	if fetched {
+		checkDetectedCluster(cbStatsApi, body, err)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, cbemxStruct)
+}
+
+// Hostnames of the nodes running a service
+func (s *scrape) serviceNodes(service string) []string {
+	var hostnames []string
+	var cbemxClusterStatusStruct cbemxClusterStatusDetails
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return hostnames
+	}
+	for _, node := range cbemxClusterStatusStruct.Nodes {
+		for _, nodeService := range node.Services {
+			if nodeService == service {
+				hostnames = append(hostnames, node.Hostname)
+			}
+		}
+	}
+	return hostnames
+}
+
+// Services per node keyed by hostname without port
+func (s *scrape) nodeServices() map[string][]string {
+	var cbemxClusterStatusStruct cbemxClusterStatusDetails
+	nodes := make(map[string][]string)
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return nodes
+	}
+	for _, node := range cbemxClusterStatusStruct.Nodes {
+		var hostname = strings.Split(node.Hostname, ":")[0]
+		nodes[hostname] = node.Services
+	}
+	return nodes
+}
+
+// Last collection of a sub-collector, served again while within the throttle time
+type cachedCollector struct {
+	subCollector
+	mu           sync.Mutex
+	lastCallTime time.Time
+	metrics      []prometheus.Metric
+}
+
+// Metrics Collector Structure, dispatching to the enabled sub-collectors
+type MetricsCollector struct {
+	collectors             []*cachedCollector
+	filtered_objects_count *prometheus.Desc
+	dropped_series_count   *prometheus.Desc
+}
+
+// Collector registered with prometheus, also used for per request collector selection
+var emxCollector *MetricsCollector
+
+// Creating custom metric collector
+func metricsCollector() *MetricsCollector {
+
+	level.Info(logger).Log("Event", "Initializing the metrics creation through collector")
+
+	collector := &MetricsCollector{
+		filtered_objects_count: newEmxDesc("filtered_objects_count",
+			"The number of objects {bucket/scope/collection/index} excluded by the include/exclude filters.",
+			[]string{"cluster_uuid", "collector", "object_type"},
+		),
+		dropped_series_count: newEmxDesc("dropped_series_count",
+			"The number of series dropped by the per metric family series limit.",
+			[]string{"cluster_uuid", "collector", "family"},
+		),
+	}
+	for _, c := range enabledCollectors() {
+		collector.collectors = append(collector.collectors, &cachedCollector{subCollector: c})
+	}
+	return collector
+}
+
+/*
+* Collector restricted to the named sub-collectors, sharing their caches with
+* the full collector so that differently filtered scrapes don't refetch each other's endpoints.
+ */
+func (collector *MetricsCollector) filtered(names []string) (*MetricsCollector, error) {
+	filtered := &MetricsCollector{
+		filtered_objects_count: collector.filtered_objects_count,
+		dropped_series_count:   collector.dropped_series_count,
+	}
+	// a collector listed twice would emit every series twice
+	var seen = make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		var found = false
+		for _, c := range collector.collectors {
+			if c.Name() == name {
+				filtered.collectors = append(filtered.collectors, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown or disabled collector '%s'", name)
+		}
+	}
+	return filtered, nil
+}
+
+// Defining the channel collection for the custom collector
+func (collector *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range collector.collectors {
+		c.Describe(ch)
+	}
+	ch <- collector.filtered_objects_count
+	ch <- collector.dropped_series_count
+}
+
+// Minimum time between two collections of the same sub-collector
+func throttleTime() time.Duration {
+	var throttle_time, err = strconv.Atoi(os.Getenv("EMX_THROTTLE_TIME"))
+	if err != nil {
+		throttle_time = EMX_THROTTLE_TIME
+	}
+	return time.Duration(throttle_time) * time.Second
+}
+
+/*
+Implementing the channel collection of metrics for the custom collector
+Generates the Prometheus formatted metrics output.
+Sub-collectors are throttled individually, a sub-collector scraped again within
+EMX_THROTTLE_TIME seconds serves the metrics of its last collection.
+*/
+func (collector *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	var s *scrape
+
+	for _, c := range collector.collectors {
+		c.mu.Lock()
+		if since := time.Since(c.lastCallTime); since < throttleTime() {
+			level.Info(logger).Log("Event", "Serving cached metrics for collector '"+c.Name()+"', last collected "+since.String()+" ago.")
+		} else {
+			c.lastCallTime = time.Now()
+			if s == nil {
+				// Getting the Couchbase cluster and and its related details
+				level.Info(logger).Log("Event", "Fetching the EMX stats details of couchbase host")
+				s = newScrape()
+			}
+			level.Info(logger).Log("Event", "Generating metrics for collector '"+c.Name()+"'.")
+			c.metrics = collector.limitSeries(c.Name(), s, collectMetrics(c.subCollector, s))
+		}
+		for _, metric := range c.metrics {
+			ch <- metric
+		}
+		c.mu.Unlock()
+	}
+
+	level.Info(logger).Log("Event", "Channelled all the metrics to the collector")
+
+}
+
+// Run a sub-collector, returning everything it produced even if it failed part way
+func collectMetrics(c subCollector, s *scrape) []prometheus.Metric {
+	var (
+		metrics []prometheus.Metric
+		err     error
+	)
+	s.filtered = make(map[string]map[string]bool)
+	if capable, ok := c.(capabilityCollector); ok && !s.has(capable.requiredCapability()) {
+		level.Info(logger).Log("Event", "Skipping collector '"+c.Name()+"', the cluster at "+s.effectiveVersion().String()+" lacks '"+capable.requiredCapability()+"'")
+		return nil
+	}
+	buffer := make(chan prometheus.Metric)
+	go func() {
+		err = c.Collect(s, buffer)
+		close(buffer)
+	}()
+	for metric := range buffer {
+		metrics = append(metrics, metric)
+	}
+	if err != nil {
+		level.Error(logger).Log("Error", "Collector '"+c.Name()+"' failed: "+err.Error())
+	}
+	return metrics
+}
+
+/*
+* Handler for the /metrics endpoint.
+* /metrics?collect[]=buckets&collect[]=autofailover only runs the named collectors,
+* without collect[] all enabled collectors and the exporter's own metrics are served.
+ */
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["collect[]"]
+		if len(names) == 0 || emxCollector == nil {
+			promhttp.Handler().ServeHTTP(w, r)
+			return
+		}
+		filtered, err := emxCollector.filtered(names)
+		if err != nil {
+			level.Error(logger).Log("Error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(filtered)
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
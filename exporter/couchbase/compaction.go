@@ -0,0 +1,217 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_AutoCompaction
+type cbemxAutoCompactionDetails struct {
+	AutoCompactionSettings cbemxCompactionSettingsDetails `json:"autoCompactionSettings"`
+	PurgeInterval          float64                        `json:"purgeInterval"`
+}
+
+// Compaction settings of the cluster, or of a bucket overriding them
+type cbemxCompactionSettingsDetails struct {
+	ParallelDBAndViewCompaction    bool                        `json:"parallelDBAndViewCompaction"`
+	DatabaseFragmentationThreshold cbemxFragmentationThreshold `json:"databaseFragmentationThreshold"`
+	ViewFragmentationThreshold     cbemxFragmentationThreshold `json:"viewFragmentationThreshold"`
+	MagmaFragmentationPercentage   float64                     `json:"magmaFragmentationPercentage"`
+	AllowedTimePeriod              *cbemxCompactionTimePeriod  `json:"allowedTimePeriod"`
+}
+
+// Fragmentation threshold, either value is "undefined" when not set
+type cbemxFragmentationThreshold struct {
+	Percentage json.RawMessage `json:"percentage"`
+	Size       json.RawMessage `json:"size"`
+}
+
+// Time window compaction may run in
+type cbemxCompactionTimePeriod struct {
+	FromHour     int  `json:"fromHour"`
+	FromMinute   int  `json:"fromMinute"`
+	ToHour       int  `json:"toHour"`
+	ToMinute     int  `json:"toMinute"`
+	AbortOutside bool `json:"abortOutside"`
+}
+
+// Per bucket compaction override from CBEMXENDPOINT_BucketStats, false when using the cluster settings
+type cbemxBucketCompactionDetails struct {
+	BucketName             string          `json:"name"`
+	AutoCompactionSettings json.RawMessage `json:"autoCompactionSettings"`
+}
+
+// Numeric value of a threshold, 0 when "undefined"
+func thresholdValue(raw json.RawMessage) float64 {
+	var value float64
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return 0
+	}
+	return value
+}
+
+// Auto-compaction and fragmentation settings
+type compactionCollector struct {
+	compaction_db_fragmentation_threshold_percent   *prometheus.Desc
+	compaction_db_fragmentation_threshold_size      *prometheus.Desc
+	compaction_view_fragmentation_threshold_percent *prometheus.Desc
+	compaction_view_fragmentation_threshold_size    *prometheus.Desc
+	compaction_magma_fragmentation_percent          *prometheus.Desc
+	compaction_parallel_db_and_view                 *prometheus.Desc
+	compaction_time_window_enabled                  *prometheus.Desc
+	compaction_time_window_from_minutes             *prometheus.Desc
+	compaction_time_window_to_minutes               *prometheus.Desc
+	compaction_time_window_abort_outside            *prometheus.Desc
+	compaction_purge_interval_days                  *prometheus.Desc
+	bucket_compaction_override                      *prometheus.Desc
+	bucket_db_fragmentation_threshold_percent       *prometheus.Desc
+	bucket_view_fragmentation_threshold_percent     *prometheus.Desc
+	bucket_magma_fragmentation_percent              *prometheus.Desc
+}
+
+func init() {
+	registerCollector("compaction", true, newCompactionCollector)
+}
+
+func newCompactionCollector() subCollector {
+	return &compactionCollector{
+		compaction_db_fragmentation_threshold_percent: newEmxDesc("compaction_db_fragmentation_threshold_percent",
+			"The database fragmentation percentage triggering compaction, 0 if not set.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_db_fragmentation_threshold_size: newEmxDesc("compaction_db_fragmentation_threshold_size",
+			"The database fragmentation size in bytes triggering compaction, 0 if not set.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_view_fragmentation_threshold_percent: newEmxDesc("compaction_view_fragmentation_threshold_percent",
+			"The view fragmentation percentage triggering compaction, 0 if not set.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_view_fragmentation_threshold_size: newEmxDesc("compaction_view_fragmentation_threshold_size",
+			"The view fragmentation size in bytes triggering compaction, 0 if not set.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_magma_fragmentation_percent: newEmxDesc("compaction_magma_fragmentation_percent",
+			"The fragmentation percentage triggering compaction of magma buckets.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_parallel_db_and_view: newEmxDesc("compaction_parallel_db_and_view",
+			"Database and view compaction run in parallel 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_time_window_enabled: newEmxDesc("compaction_time_window_enabled",
+			"Compaction is restricted to an allowed time window 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_time_window_from_minutes: newEmxDesc("compaction_time_window_from_minutes",
+			"The start of the allowed compaction time window in minutes after midnight.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_time_window_to_minutes: newEmxDesc("compaction_time_window_to_minutes",
+			"The end of the allowed compaction time window in minutes after midnight.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_time_window_abort_outside: newEmxDesc("compaction_time_window_abort_outside",
+			"Compaction is aborted outside the allowed time window 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		compaction_purge_interval_days: newEmxDesc("compaction_purge_interval_days",
+			"The metadata purge interval in days.",
+			[]string{"cluster_uuid"},
+		),
+		bucket_compaction_override: newEmxDesc("bucket_compaction_override",
+			"The bucket overrides the cluster auto-compaction settings 0/1 --> false/true.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+		bucket_db_fragmentation_threshold_percent: newEmxDesc("bucket_db_fragmentation_threshold_percent",
+			"The effective database fragmentation percentage triggering compaction of the bucket, 0 if not set.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+		bucket_view_fragmentation_threshold_percent: newEmxDesc("bucket_view_fragmentation_threshold_percent",
+			"The effective view fragmentation percentage triggering compaction of the bucket, 0 if not set.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+		bucket_magma_fragmentation_percent: newEmxDesc("bucket_magma_fragmentation_percent",
+			"The effective fragmentation percentage triggering compaction of the bucket if magma.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+	}
+}
+
+func (collector *compactionCollector) Name() string {
+	return "compaction"
+}
+
+func (collector *compactionCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_AutoCompaction, CBEMXENDPOINT_BucketStats}
+}
+
+func (collector *compactionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.compaction_db_fragmentation_threshold_percent
+	ch <- collector.compaction_db_fragmentation_threshold_size
+	ch <- collector.compaction_view_fragmentation_threshold_percent
+	ch <- collector.compaction_view_fragmentation_threshold_size
+	ch <- collector.compaction_magma_fragmentation_percent
+	ch <- collector.compaction_parallel_db_and_view
+	ch <- collector.compaction_time_window_enabled
+	ch <- collector.compaction_time_window_from_minutes
+	ch <- collector.compaction_time_window_to_minutes
+	ch <- collector.compaction_time_window_abort_outside
+	ch <- collector.compaction_purge_interval_days
+	ch <- collector.bucket_compaction_override
+	ch <- collector.bucket_db_fragmentation_threshold_percent
+	ch <- collector.bucket_view_fragmentation_threshold_percent
+	ch <- collector.bucket_magma_fragmentation_percent
+}
+
+func (collector *compactionCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                       []error
+		cbemxAutoCompactionStruct  cbemxAutoCompactionDetails
+		cbemxBucketCompactionArray []cbemxBucketCompactionDetails
+	)
+
+	if err := s.get(CBEMXENDPOINT_AutoCompaction, &cbemxAutoCompactionStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		settings := cbemxAutoCompactionStruct.AutoCompactionSettings
+		ch <- prometheus.MustNewConstMetric(collector.compaction_db_fragmentation_threshold_percent, prometheus.GaugeValue, thresholdValue(settings.DatabaseFragmentationThreshold.Percentage), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.compaction_db_fragmentation_threshold_size, prometheus.GaugeValue, thresholdValue(settings.DatabaseFragmentationThreshold.Size), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.compaction_view_fragmentation_threshold_percent, prometheus.GaugeValue, thresholdValue(settings.ViewFragmentationThreshold.Percentage), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.compaction_view_fragmentation_threshold_size, prometheus.GaugeValue, thresholdValue(settings.ViewFragmentationThreshold.Size), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.compaction_magma_fragmentation_percent, prometheus.GaugeValue, settings.MagmaFragmentationPercentage, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.compaction_parallel_db_and_view, prometheus.GaugeValue, float64(boolVal(settings.ParallelDBAndViewCompaction)), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.compaction_time_window_enabled, prometheus.GaugeValue, float64(boolVal(settings.AllowedTimePeriod != nil)), s.uuid)
+		if window := settings.AllowedTimePeriod; window != nil {
+			ch <- prometheus.MustNewConstMetric(collector.compaction_time_window_from_minutes, prometheus.GaugeValue, float64(window.FromHour*60+window.FromMinute), s.uuid)
+			ch <- prometheus.MustNewConstMetric(collector.compaction_time_window_to_minutes, prometheus.GaugeValue, float64(window.ToHour*60+window.ToMinute), s.uuid)
+			ch <- prometheus.MustNewConstMetric(collector.compaction_time_window_abort_outside, prometheus.GaugeValue, float64(boolVal(window.AbortOutside)), s.uuid)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.compaction_purge_interval_days, prometheus.GaugeValue, cbemxAutoCompactionStruct.PurgeInterval, s.uuid)
+	}
+
+	if err := s.get(CBEMXENDPOINT_BucketStats, &cbemxBucketCompactionArray); err != nil {
+		errs = append(errs, err)
+		return errors.Join(errs...)
+	}
+	for _, bucket := range cbemxBucketCompactionArray {
+		if !s.include("bucket", bucket.BucketName) {
+			continue
+		}
+		// "autoCompactionSettings": false when the bucket uses the cluster settings
+		var override cbemxCompactionSettingsDetails
+		var overridden = json.Unmarshal(bucket.AutoCompactionSettings, &override) == nil && string(bucket.AutoCompactionSettings) != "false"
+		effective := cbemxAutoCompactionStruct.AutoCompactionSettings
+		if overridden {
+			effective = override
+		}
+		ch <- prometheus.MustNewConstMetric(collector.bucket_compaction_override, prometheus.GaugeValue, float64(boolVal(overridden)), s.uuid, bucket.BucketName)
+		ch <- prometheus.MustNewConstMetric(collector.bucket_db_fragmentation_threshold_percent, prometheus.GaugeValue, thresholdValue(effective.DatabaseFragmentationThreshold.Percentage), s.uuid, bucket.BucketName)
+		ch <- prometheus.MustNewConstMetric(collector.bucket_view_fragmentation_threshold_percent, prometheus.GaugeValue, thresholdValue(effective.ViewFragmentationThreshold.Percentage), s.uuid, bucket.BucketName)
+		ch <- prometheus.MustNewConstMetric(collector.bucket_magma_fragmentation_percent, prometheus.GaugeValue, effective.MagmaFragmentationPercentage, s.uuid, bucket.BucketName)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,202 @@
+package couchbase
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+* Bucket and scope owning a function from 7.1, functions of different scopes may share a name.
+* Missing before 7.1 and "*" for functions created without a scope.
+ */
+type cbemxEventingFunctionScope struct {
+	Bucket string `json:"bucket"`
+	Scope  string `json:"scope"`
+}
+
+// Label value of the scope, "<bucket>/<scope>", empty before 7.1
+func (scope cbemxEventingFunctionScope) String() string {
+	if scope.Bucket == "" {
+		return ""
+	}
+	return scope.Bucket + "/" + scope.Scope
+}
+
+// Fully qualified function name to match definitions, status and stats
+type eventingFunctionKey struct {
+	scope string
+	name  string
+}
+
+// per function from CBEMXENDPOINT_EventingFunctions
+type cbemxEventingFunctionDetails struct {
+	AppName       string                     `json:"appname"`
+	FunctionScope cbemxEventingFunctionScope `json:"function_scope"`
+	Depcfg        struct {
+		SourceBucket string `json:"source_bucket"`
+	} `json:"depcfg"`
+	Settings struct {
+		WorkerCount           int    `json:"worker_count"`
+		LanguageCompatibility string `json:"language_compatibility"`
+		DcpStreamBoundary     string `json:"dcp_stream_boundary"`
+	} `json:"settings"`
+}
+
+// CBEMXENDPOINT_EventingStatus
+type cbemxEventingStatusDetails struct {
+	Apps []struct {
+		Name            string                     `json:"name"`
+		FunctionScope   cbemxEventingFunctionScope `json:"function_scope"`
+		CompositeStatus string                     `json:"composite_status"`
+	} `json:"apps"`
+}
+
+// per function from CBEMXENDPOINT_EventingStats, counters since the function was deployed on the node
+type cbemxEventingStatsDetails struct {
+	FunctionName  string                     `json:"function_name"`
+	FunctionScope cbemxEventingFunctionScope `json:"function_scope"`
+	FailureStats  map[string]float64         `json:"failure_stats"`
+}
+
+// Label options for radio select metric streams
+var EVENTING_FUNCTION_STATUS = [...]string{"deployed", "undeployed", "paused", "deploying", "undeploying", "pausing"}
+var EVENTING_DCP_STREAM_BOUNDARY = [...]string{"everything", "from_now", "from_prior"}
+
+// Eventing function deployment and failures
+type eventingCollector struct {
+	eventing_function_status                 *prometheus.Desc
+	eventing_function_worker_count           *prometheus.Desc
+	eventing_function_language_compatibility *prometheus.Desc
+	eventing_function_dcp_stream_boundary    *prometheus.Desc
+	eventing_function_timeout_counter        *prometheus.Desc
+	eventing_function_failure_counter        *prometheus.Desc
+}
+
+func init() {
+	registerCollector("eventing", true, newEventingCollector)
+}
+
+func newEventingCollector() subCollector {
+	var functionLabels = []string{"cluster_uuid", "function", "function_scope", "bucket"}
+	return &eventingCollector{
+		eventing_function_status: newEmxDesc("eventing_function_status",
+			"Eventing function status {deployed/undeployed/paused/deploying/undeploying/pausing} selected state(1 - selected).",
+			withLabel(functionLabels, "status"),
+		),
+		eventing_function_worker_count: newEmxDesc("eventing_function_worker_count",
+			"The number of workers of an eventing function per eventing node.",
+			functionLabels,
+		),
+		eventing_function_language_compatibility: newEmxDesc("eventing_function_language_compatibility",
+			"The language compatibility version of an eventing function, always 1.",
+			withLabel(functionLabels, "version"),
+		),
+		eventing_function_dcp_stream_boundary: newEmxDesc("eventing_function_dcp_stream_boundary",
+			"Eventing function feed boundary {everything/from_now/from_prior} selected state(1 - selected).",
+			withLabel(functionLabels, "boundary"),
+		),
+		eventing_function_timeout_counter: newEmxDesc("eventing_function_timeout_counter",
+			"The number of handler executions that timed out summed over all eventing nodes.",
+			functionLabels,
+		),
+		eventing_function_failure_counter: newEmxDesc("eventing_function_failure_counter",
+			"The number of failures by failure stat summed over all eventing nodes.",
+			withLabel(functionLabels, "failure"),
+		),
+	}
+}
+
+func (collector *eventingCollector) Name() string {
+	return "eventing"
+}
+
+func (collector *eventingCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus, ":8096" + CBEMXENDPOINT_EventingFunctions, ":8096" + CBEMXENDPOINT_EventingStatus, ":8096" + CBEMXENDPOINT_EventingStats}
+}
+
+func (collector *eventingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.eventing_function_status
+	ch <- collector.eventing_function_worker_count
+	ch <- collector.eventing_function_language_compatibility
+	ch <- collector.eventing_function_dcp_stream_boundary
+	ch <- collector.eventing_function_timeout_counter
+	ch <- collector.eventing_function_failure_counter
+}
+
+func (collector *eventingCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                        []error
+		cbemxEventingFunctionsArray []cbemxEventingFunctionDetails
+		cbemxEventingStatusStruct   cbemxEventingStatusDetails
+	)
+	var eventingNodes = s.serviceNodes("eventing")
+	if len(eventingNodes) == 0 {
+		return nil
+	}
+	// function definitions and status are cluster wide, any eventing node serves them
+	if err := s.getAnyService(eventingNodes, "eventing", CBEMXENDPOINT_EventingFunctions, &cbemxEventingFunctionsArray); err != nil {
+		return err
+	}
+	var status = make(map[eventingFunctionKey]string)
+	if err := s.getAnyService(eventingNodes, "eventing", CBEMXENDPOINT_EventingStatus, &cbemxEventingStatusStruct); err != nil {
+		errs = append(errs, err)
+	}
+	for _, app := range cbemxEventingStatusStruct.Apps {
+		status[eventingFunctionKey{app.FunctionScope.String(), app.Name}] = app.CompositeStatus
+	}
+
+	// failure stats are per node
+	var failures = make(map[eventingFunctionKey]map[string]float64)
+	for _, hostname := range eventingNodes {
+		var cbemxEventingStatsArray []cbemxEventingStatsDetails
+		if err := s.getService(hostname, "eventing", CBEMXENDPOINT_EventingStats, &cbemxEventingStatsArray); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, stats := range cbemxEventingStatsArray {
+			var key = eventingFunctionKey{stats.FunctionScope.String(), stats.FunctionName}
+			if failures[key] == nil {
+				failures[key] = make(map[string]float64)
+			}
+			for failure, count := range stats.FailureStats {
+				failures[key][failure] += count
+			}
+		}
+	}
+
+	for _, function := range cbemxEventingFunctionsArray {
+		if !s.include("bucket", function.Depcfg.SourceBucket) {
+			continue
+		}
+		var key = eventingFunctionKey{function.FunctionScope.String(), function.AppName}
+		var labels = []string{s.uuid, function.AppName, key.scope, function.Depcfg.SourceBucket}
+		for _, option := range EVENTING_FUNCTION_STATUS {
+			ch <- prometheus.MustNewConstMetric(collector.eventing_function_status, prometheus.GaugeValue, float64(boolVal(option == status[key])), withLabel(labels, option)...)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.eventing_function_worker_count, prometheus.GaugeValue, float64(function.Settings.WorkerCount), labels...)
+		ch <- prometheus.MustNewConstMetric(collector.eventing_function_language_compatibility, prometheus.GaugeValue, 1, withLabel(labels, function.Settings.LanguageCompatibility)...)
+		for _, option := range EVENTING_DCP_STREAM_BOUNDARY {
+			ch <- prometheus.MustNewConstMetric(collector.eventing_function_dcp_stream_boundary, prometheus.GaugeValue, float64(boolVal(option == function.Settings.DcpStreamBoundary)), withLabel(labels, option)...)
+		}
+
+		functionFailures, ok := failures[key]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.eventing_function_timeout_counter, prometheus.CounterValue, functionFailures["timeout_count"], labels...)
+		var failureNames []string
+		for failure := range functionFailures {
+			if failure != "timeout_count" {
+				failureNames = append(failureNames, failure)
+			}
+		}
+		sort.Strings(failureNames)
+		for _, failure := range failureNames {
+			ch <- prometheus.MustNewConstMetric(collector.eventing_function_failure_counter, prometheus.CounterValue, functionFailures[failure], withLabel(labels, failure)...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,29 @@
+package couchbase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFunctionsSharingNameInScopes(t *testing.T) {
+	collector := newReplayCollector(t, "eventing", "eventing")
+
+	expected := `
+# HELP eventing_function_worker_count The number of workers of an eventing function per eventing node.
+# TYPE eventing_function_worker_count gauge
+eventing_function_worker_count{bucket="bucket-1",cluster_uuid="00000000000000000000000000000001",function="enrich",function_scope="bucket-1/scope-1"} 1
+eventing_function_worker_count{bucket="bucket-1",cluster_uuid="00000000000000000000000000000001",function="enrich",function_scope="bucket-2/scope-1"} 2
+# HELP eventing_function_timeout_counter The number of handler executions that timed out summed over all eventing nodes.
+# TYPE eventing_function_timeout_counter counter
+eventing_function_timeout_counter{bucket="bucket-1",cluster_uuid="00000000000000000000000000000001",function="enrich",function_scope="bucket-1/scope-1"} 3
+eventing_function_timeout_counter{bucket="bucket-1",cluster_uuid="00000000000000000000000000000001",function="enrich",function_scope="bucket-2/scope-1"} 7
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "eventing_function_worker_count", "eventing_function_timeout_counter"); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(collector, "eventing_function_status"); count != 2*len(EVENTING_FUNCTION_STATUS) {
+		t.Errorf("%d eventing_function_status series, expected %d", count, 2*len(EVENTING_FUNCTION_STATUS))
+	}
+}
@@ -0,0 +1,280 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_Logs, the UI log
+type cbemxLogsDetails struct {
+	List []struct {
+		Node   string `json:"node"`
+		Module string `json:"module"`
+		Tstamp int64  `json:"tstamp"` // ms since epoch
+		Text   string `json:"text"`
+	} `json:"list"`
+}
+
+// CBEMXENDPOINT_Events, the system event log from 7.1
+type cbemxEventsDetails struct {
+	Events []struct {
+		Timestamp       string                 `json:"timestamp"`
+		Component       string                 `json:"component"`
+		Description     string                 `json:"description"`
+		Node            string                 `json:"node"`
+		ExtraAttributes map[string]interface{} `json:"extra_attributes"`
+	} `json:"events"`
+}
+
+// A rebalance or failover event from either log
+type clusterEvent struct {
+	time   time.Time
+	kind   string
+	nodes  []string
+	reason string
+}
+
+// Event kinds recognised in the logs, failover kinds end in the failover type
+const (
+	EVENT_REBALANCE_START = "rebalance_start"
+	EVENT_FAILOVER        = "failover_"
+)
+
+// Label options for radio select metric streams
+var REBALANCE_RESULTS = [...]string{"success", "failed", "stopped"}
+
+var otpNodePattern = regexp.MustCompile(`ns_1@[^'"\]\[\s,)]+`)
+
+// Rebalance and failover history from the cluster logs
+type eventsCollector struct {
+	last_failover_timestamp_seconds  *prometheus.Desc
+	last_rebalance_result            *prometheus.Desc
+	last_rebalance_timestamp_seconds *prometheus.Desc
+	rebalance_duration_seconds       *prometheus.Desc
+	autofailover_reason_count        *prometheus.Desc
+}
+
+func init() {
+	registerCollector("events", true, newEventsCollector)
+}
+
+func newEventsCollector() subCollector {
+	return &eventsCollector{
+		last_failover_timestamp_seconds: newEmxDesc("last_failover_timestamp_seconds",
+			"The time of the last failover of a node by failover type {hard/graceful/auto} in seconds since epoch.",
+			[]string{"cluster_uuid", "node", "type"},
+		),
+		last_rebalance_result: newEmxDesc("last_rebalance_result",
+			"The result of the last finished rebalance {success/failed/stopped} selected state(1 - selected).",
+			[]string{"cluster_uuid", "result"},
+		),
+		last_rebalance_timestamp_seconds: newEmxDesc("last_rebalance_timestamp_seconds",
+			"The time the last rebalance finished in seconds since epoch.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_duration_seconds: newEmxDesc("rebalance_duration_seconds",
+			"The duration of the last finished rebalance in seconds.",
+			[]string{"cluster_uuid"},
+		),
+		autofailover_reason_count: newEmxDesc("autofailover_reason_count",
+			"The number of automatic failovers in the cluster log by reason.",
+			[]string{"cluster_uuid", "reason"},
+		),
+	}
+}
+
+func (collector *eventsCollector) Name() string {
+	return "events"
+}
+
+func (collector *eventsCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_Events, CBEMXENDPOINT_Logs}
+}
+
+func (collector *eventsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.last_failover_timestamp_seconds
+	ch <- collector.last_rebalance_result
+	ch <- collector.last_rebalance_timestamp_seconds
+	ch <- collector.rebalance_duration_seconds
+	ch <- collector.autofailover_reason_count
+}
+
+// Hostnames of the erlang node names mentioned in a text
+func otpNodes(text string) []string {
+	var nodes []string
+	for _, node := range otpNodePattern.FindAllString(text, -1) {
+		nodes = appendUnique(nodes, bareHost(node))
+	}
+	return nodes
+}
+
+/*
+* Classify a UI log message, e.g. "Rebalance completed successfully." or
+* "Node ('ns_1@10.0.0.2') was automatically failed over. Reason: ...".
+* Returns an empty kind for unrelated messages.
+ */
+func classifyLogText(text string) (kind string, reason string) {
+	switch {
+	case strings.HasPrefix(text, "Starting rebalance"):
+		kind = EVENT_REBALANCE_START
+	case strings.HasPrefix(text, "Rebalance completed successfully"):
+		kind = "success"
+	case strings.HasPrefix(text, "Rebalance stopped"), strings.HasPrefix(text, "Rebalance exited with reason stop"):
+		kind = "stopped"
+	case strings.HasPrefix(text, "Rebalance exited"), strings.HasPrefix(text, "Rebalance failed"):
+		kind = "failed"
+	case strings.HasPrefix(text, "Starting graceful failover"):
+		kind = EVENT_FAILOVER + "graceful"
+	case strings.Contains(text, "was automatically failed over"):
+		kind = EVENT_FAILOVER + "auto"
+		// the first sentence names the reason, the rest are hints
+		if _, after, found := strings.Cut(text, "Reason: "); found {
+			reason, _, _ = strings.Cut(strings.TrimSpace(after), ". ")
+			reason = strings.TrimSuffix(reason, ".")
+		}
+	case strings.HasPrefix(text, "Starting failing over"):
+		kind = EVENT_FAILOVER + "hard"
+	}
+	return kind, reason
+}
+
+/*
+* Classify a system event by its description, e.g. "Rebalance completed" or
+* "Auto failover initiated".
+ */
+func classifyEventDescription(description string) string {
+	switch description {
+	case "Rebalance initiated":
+		return EVENT_REBALANCE_START
+	case "Rebalance completed":
+		return "success"
+	case "Rebalance failed":
+		return "failed"
+	case "Rebalance stopped":
+		return "stopped"
+	case "Graceful failover initiated":
+		return EVENT_FAILOVER + "graceful"
+	case "Hard failover initiated":
+		return EVENT_FAILOVER + "hard"
+	case "Auto failover initiated":
+		return EVENT_FAILOVER + "auto"
+	}
+	return ""
+}
+
+// Rebalance and failover events of the system event log, from 7.1
+func decodeSystemEvents(body []byte, v interface{}) error {
+	events, ok := v.(*[]clusterEvent)
+	if !ok {
+		return fmt.Errorf("cannot decode the system event log into %T", v)
+	}
+	var cbemxEventsStruct cbemxEventsDetails
+	if err := json.Unmarshal(body, &cbemxEventsStruct); err != nil {
+		return err
+	}
+	for _, event := range cbemxEventsStruct.Events {
+		var kind = classifyEventDescription(event.Description)
+		timestamp, err := time.Parse(time.RFC3339, event.Timestamp)
+		if kind == "" || err != nil {
+			continue
+		}
+		var reason, _ = event.ExtraAttributes["reason"].(string)
+		attributes, _ := json.Marshal(event.ExtraAttributes)
+		var nodes = otpNodes(string(attributes))
+		if len(nodes) == 0 && strings.HasPrefix(kind, EVENT_FAILOVER) {
+			nodes = []string{bareHost(event.Node)}
+		}
+		*events = append(*events, clusterEvent{time: timestamp, kind: kind, nodes: nodes, reason: reason})
+	}
+	return nil
+}
+
+// Rebalance and failover events of the UI log
+func decodeUILog(body []byte, v interface{}) error {
+	events, ok := v.(*[]clusterEvent)
+	if !ok {
+		return fmt.Errorf("cannot decode the UI log into %T", v)
+	}
+	var cbemxLogsStruct cbemxLogsDetails
+	if err := json.Unmarshal(body, &cbemxLogsStruct); err != nil {
+		return err
+	}
+	for _, entry := range cbemxLogsStruct.List {
+		kind, reason := classifyLogText(entry.Text)
+		if kind == "" {
+			continue
+		}
+		*events = append(*events, clusterEvent{time: time.UnixMilli(entry.Tstamp), kind: kind, nodes: otpNodes(entry.Text), reason: reason})
+	}
+	return nil
+}
+
+func (collector *eventsCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	// from the system event log when available and the UI log otherwise
+	var events []clusterEvent
+	if err := s.getVersioned("cluster_events", &events); err != nil {
+		return err
+	}
+	// oldest first, so later events overwrite earlier ones
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+
+	type failoverKey struct {
+		node         string
+		failoverType string
+	}
+	var (
+		lastFailover   = make(map[failoverKey]time.Time)
+		reasons        = make(map[string]int)
+		rebalanceStart time.Time
+		lastRebalance  *clusterEvent
+		duration       time.Duration
+	)
+	for i, event := range events {
+		switch {
+		case event.kind == EVENT_REBALANCE_START:
+			rebalanceStart = event.time
+		case strings.HasPrefix(event.kind, EVENT_FAILOVER):
+			var failoverType = strings.TrimPrefix(event.kind, EVENT_FAILOVER)
+			for _, node := range event.nodes {
+				lastFailover[failoverKey{node, failoverType}] = event.time
+			}
+			if failoverType == "auto" {
+				reasons[event.reason]++
+			}
+		default:
+			lastRebalance = &events[i]
+			duration = 0
+			// only the start of this rebalance counts, it may have been trimmed from the log
+			if !rebalanceStart.IsZero() && !rebalanceStart.After(event.time) {
+				duration = event.time.Sub(rebalanceStart)
+			}
+			rebalanceStart = time.Time{}
+		}
+	}
+
+	for key, timestamp := range lastFailover {
+		ch <- prometheus.MustNewConstMetric(collector.last_failover_timestamp_seconds, prometheus.GaugeValue, float64(timestamp.Unix()), s.uuid, key.node, key.failoverType)
+	}
+	for reason, count := range reasons {
+		ch <- prometheus.MustNewConstMetric(collector.autofailover_reason_count, prometheus.GaugeValue, float64(count), s.uuid, reason)
+	}
+	if lastRebalance == nil {
+		return nil
+	}
+	for _, option := range REBALANCE_RESULTS {
+		ch <- prometheus.MustNewConstMetric(collector.last_rebalance_result, prometheus.GaugeValue, float64(boolVal(option == lastRebalance.kind)), s.uuid, option)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.last_rebalance_timestamp_seconds, prometheus.GaugeValue, float64(lastRebalance.time.Unix()), s.uuid)
+	if duration > 0 {
+		ch <- prometheus.MustNewConstMetric(collector.rebalance_duration_seconds, prometheus.GaugeValue, duration.Seconds(), s.uuid)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package couchbase
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Object types that can be filtered by name
+var FILTER_OBJECT_TYPES = [...]string{"bucket", "scope", "collection", "index"}
+
+// Include/exclude regexes for one object type, both matched against the full name
+type objectFilter struct {
+	includeExpr *string
+	excludeExpr *string
+	include     *regexp.Regexp
+	exclude     *regexp.Regexp
+}
+
+func (f *objectFilter) matches(name string) bool {
+	if f.include != nil && !f.include.MatchString(name) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// Filters per object type
+var objectFilters = make(map[string]*objectFilter)
+
+// Maximum number of series per metric family, 0 for no limit
+var maxSeriesPerFamily *int
+
+/*
+* Define --filter.<type>.include and --filter.<type>.exclude for buckets, scopes, collections and indexes
+* and --filter.max-series-per-family. Must be called before flag.Parse().
+* Indexes in the _system scope are excluded by default.
+ */
+func RegisterFilterFlags() {
+	for _, objectType := range FILTER_OBJECT_TYPES {
+		var defaultExclude = ""
+		if objectType == "scope" {
+			defaultExclude = "_system"
+		}
+		objectFilters[objectType] = &objectFilter{
+			includeExpr: flag.String("filter."+objectType+".include", "", "Regex of "+objectType+" names to export, all if empty"),
+			excludeExpr: flag.String("filter."+objectType+".exclude", defaultExclude, "Regex of "+objectType+" names not to export"),
+		}
+	}
+	maxSeriesPerFamily = flag.Int("filter.max-series-per-family", 0, "Maximum number of series exported per metric family, 0 for no limit")
+}
+
+// Compile the filter flags, must be called after flag.Parse()
+func ConfigureFilters() error {
+	for _, objectType := range FILTER_OBJECT_TYPES {
+		f, ok := objectFilters[objectType]
+		if !ok {
+			continue
+		}
+		var err error
+		if *f.includeExpr != "" {
+			if f.include, err = regexp.Compile("^(?:" + *f.includeExpr + ")$"); err != nil {
+				return fmt.Errorf("invalid --filter.%s.include: %v", objectType, err)
+			}
+			level.Info(logger).Log("Event", "Exporting only "+objectType+"s matching '"+*f.includeExpr+"'")
+		}
+		if *f.excludeExpr != "" {
+			if f.exclude, err = regexp.Compile("^(?:" + *f.excludeExpr + ")$"); err != nil {
+				return fmt.Errorf("invalid --filter.%s.exclude: %v", objectType, err)
+			}
+			level.Info(logger).Log("Event", "Not exporting "+objectType+"s matching '"+*f.excludeExpr+"'")
+		}
+	}
+	if maxSeriesPerFamily != nil && *maxSeriesPerFamily > 0 {
+		level.Info(logger).Log("Event", "Exporting at most "+strconv.Itoa(*maxSeriesPerFamily)+" series per metric family")
+	}
+	return nil
+}
+
+/*
+* Whether an object passes the filters for its type.
+* Excluded names are kept for the filtered_objects_count metric of the running collector,
+* so a bucket excluded for each of its indexes is counted once.
+ */
+func (s *scrape) include(objectType string, name string) bool {
+	f, ok := objectFilters[objectType]
+	if !ok || f.matches(name) {
+		return true
+	}
+	if s.filtered[objectType] == nil {
+		s.filtered[objectType] = make(map[string]bool)
+	}
+	s.filtered[objectType][name] = true
+	return false
+}
+
+// Metric family name of a Desc
+func descName(desc *prometheus.Desc) string {
+	if name := lookupEmxDesc(desc).fqName; name != "" {
+		return name
+	}
+	return desc.String()
+}
+
+// Label values of a metric joined for sorting, the Desc is the same for the whole family
+func labelValuesKey(metric prometheus.Metric) string {
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		return ""
+	}
+	var values []string
+	for _, label := range m.GetLabel() {
+		values = append(values, label.GetName()+"="+label.GetValue())
+	}
+	return strings.Join(values, "\xff")
+}
+
+/*
+* Apply the per family series limit to the metrics of one collector run and
+* append the filter and limit metrics for the collector.
+* Series of a family over the limit are sorted by label values first,
+* so the same series are kept on every scrape whatever order the cluster answers in.
+ */
+func (collector *MetricsCollector) limitSeries(name string, s *scrape, metrics []prometheus.Metric) []prometheus.Metric {
+	var limit = 0
+	if maxSeriesPerFamily != nil {
+		limit = *maxSeriesPerFamily
+	}
+	var (
+		kept     []prometheus.Metric
+		families []*prometheus.Desc
+		series   = make(map[*prometheus.Desc][]prometheus.Metric)
+		dropped  = make(map[string]int)
+	)
+	for _, metric := range metrics {
+		desc := metric.Desc()
+		if _, ok := series[desc]; !ok {
+			families = append(families, desc)
+		}
+		series[desc] = append(series[desc], metric)
+	}
+	for _, desc := range families {
+		family := series[desc]
+		if limit > 0 && len(family) > limit {
+			keys := make(map[prometheus.Metric]string, len(family))
+			for _, metric := range family {
+				keys[metric] = labelValuesKey(metric)
+			}
+			sort.SliceStable(family, func(i, j int) bool { return keys[family[i]] < keys[family[j]] })
+			dropped[descName(desc)] += len(family) - limit
+			family = family[:limit]
+		}
+		kept = append(kept, family...)
+	}
+	for family, count := range dropped {
+		level.Info(logger).Log("Event", "Dropped "+strconv.Itoa(count)+" series of "+family+" over the limit of "+strconv.Itoa(limit))
+		kept = append(kept, prometheus.MustNewConstMetric(collector.dropped_series_count, prometheus.GaugeValue, float64(count), s.uuid, name, family))
+	}
+	for objectType, names := range s.filtered {
+		kept = append(kept, prometheus.MustNewConstMetric(collector.filtered_objects_count, prometheus.GaugeValue, float64(len(names)), s.uuid, name, objectType))
+	}
+	return kept
+}
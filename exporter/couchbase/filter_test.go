@@ -0,0 +1,53 @@
+package couchbase
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDescNameAndLabels(t *testing.T) {
+	desc := newEmxDesc("bucket_replica_count", "The number of replicas.", []string{"cluster_uuid", "bucket"})
+	if name := descName(desc); name != "bucket_replica_count" {
+		t.Errorf("desc name %s, expected bucket_replica_count", name)
+	}
+	reserved := reservedLabelNames()
+	for _, label := range []string{"cluster_uuid", "bucket", "index_name", "family"} {
+		if !reserved[label] {
+			t.Errorf("label %s not reserved", label)
+		}
+	}
+}
+
+func TestLimitSeriesKeepsSameSeries(t *testing.T) {
+	limit := 2
+	maxSeriesPerFamily = &limit
+	t.Cleanup(func() { maxSeriesPerFamily = nil })
+
+	collector := metricsCollector()
+	desc := newEmxDesc("bucket_item_count", "The number of items.", []string{"cluster_uuid", "bucket"})
+	series := func(buckets ...string) []prometheus.Metric {
+		var metrics []prometheus.Metric
+		for _, bucket := range buckets {
+			metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "uuid", bucket))
+		}
+		return metrics
+	}
+	for _, order := range [][]string{{"c", "a", "b"}, {"b", "c", "a"}} {
+		s := &scrape{uuid: "uuid"}
+		kept := collector.limitSeries("buckets", s, series(order...))
+		if len(kept) != 3 {
+			t.Fatalf("kept %d metrics for %v, expected 2 series and dropped_series_count", len(kept), order)
+		}
+		for i, bucket := range []string{"a", "b"} {
+			if expected := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "uuid", bucket); labelValuesKey(kept[i]) != labelValuesKey(expected) {
+				t.Errorf("series %d for %v is %s, expected bucket %s", i, order, labelValuesKey(kept[i]), bucket)
+			}
+		}
+		var dropped dto.Metric
+		if err := kept[2].Write(&dropped); err != nil || kept[2].Desc() != collector.dropped_series_count || dropped.GetGauge().GetValue() != 1 {
+			t.Errorf("dropped_series_count %v for %v, expected 1", dropped.GetGauge().GetValue(), order)
+		}
+	}
+}
@@ -0,0 +1,498 @@
+package couchbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Directory fixtures are written to while recording, empty when not recording
+var recordDir = ""
+
+// Directory fixtures are served from instead of the cluster, empty when not replaying
+var replayDir = ""
+
+// Pseudonyms handed out while recording, kept for the whole run so that the
+// same hostname, uuid or bucket maps to the same pseudonym in every fixture
+var fixtureRedactor = newRedactor()
+
+/*
+* Enable record mode. Every response EMX receives from the cluster is
+* redacted and written as a fixture into the given directory.
+ */
+func EnableRecording(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	recordDir = dir
+	level.Info(logger).Log("Event", "Recording redacted cluster responses into '"+dir+"'")
+	return nil
+}
+
+/*
+* Enable replay mode. Requests are answered from the fixtures in the given
+* directory and the cluster is never contacted.
+ */
+func EnableReplay(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	replayDir = dir
+	level.Info(logger).Log("Event", "Replaying cluster responses from '"+dir+"'")
+	return nil
+}
+
+/*
+* Fixture file name for a request url.
+* Cluster manager requests are named by path and query only, so that fixtures can be replayed
+* against any CB_HOST. Service requests are answered per node and also carry the node, so that
+* per node differences such as query /admin/settings survive the replay.
+* e.g. /pools/default/buckets -> pools_default_buckets.json
+* e.g. host-1:8093 /admin/settings -> host-1_8093_admin_settings.json
+ */
+func fixtureName(node string, path string, query string) string {
+	name := strings.Trim(path, "/")
+	if node != "" {
+		name = node + "_" + name
+	}
+	if query != "" {
+		name += "_" + query
+	}
+	name = regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(name, "_")
+	if name == "" {
+		name = "root"
+	}
+	return name + ".json"
+}
+
+// Node of a service request, "<host>:<port>", empty for cluster manager requests
+func fixtureNode(host string) string {
+	_, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return ""
+	}
+	for _, ports := range SERVICE_PORTS {
+		if port == ports[0] || port == ports[1] {
+			return host
+		}
+	}
+	return ""
+}
+
+// http.RoundTripper answering requests from recorded fixtures
+type replayTransport struct {
+	dir string
+}
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := http.StatusOK
+	body, err := ioutil.ReadFile(filepath.Join(t.dir, fixtureName(fixtureNode(req.URL.Host), req.URL.Path, req.URL.RawQuery)))
+	if err != nil {
+		level.Debug(logger).Log("Debug", "No fixture for "+req.URL.Path)
+		status = http.StatusNotFound
+		body = []byte{}
+	}
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Response received while recording, redacted and written once the collection is done
+type recordedResponse struct {
+	node  string
+	path  string
+	query string
+	body  []byte
+}
+
+// Responses of the current recording, see writeFixtures
+var recorded struct {
+	mu        sync.Mutex
+	responses []recordedResponse
+}
+
+// http.RoundTripper proxying requests to the cluster and keeping the responses for writeFixtures
+type recordingTransport struct {
+	next http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// hand the untouched response back to the caller
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if res.StatusCode != http.StatusOK {
+		level.Info(logger).Log("Event", "Not recording "+req.URL.Path+", status code="+fmt.Sprint(res.StatusCode))
+		return res, nil
+	}
+	if !json.Valid(body) {
+		level.Error(logger).Log("Error", "Not recording "+req.URL.Path+", response is not json")
+		return res, nil
+	}
+	recorded.mu.Lock()
+	recorded.responses = append(recorded.responses, recordedResponse{node: fixtureNode(req.URL.Host), path: req.URL.Path, query: req.URL.RawQuery, body: body})
+	recorded.mu.Unlock()
+	return res, nil
+}
+
+/*
+* Redact the recorded responses and write them into the record directory.
+* Names are collected from every response before the first fixture is written, so a
+* bucket first seen in a later response is still replaced in earlier ones. The file
+* name is built from the redacted path, which is the path EMX requests when replaying.
+ */
+func writeFixtures() (int, error) {
+	recorded.mu.Lock()
+	defer recorded.mu.Unlock()
+	docs := make([]interface{}, len(recorded.responses))
+	for i, response := range recorded.responses {
+		doc, err := fixtureRedactor.parse(response.body)
+		if err != nil {
+			return 0, err
+		}
+		docs[i] = doc
+	}
+	var written = 0
+	for i, response := range recorded.responses {
+		redacted, err := fixtureRedactor.redact(docs[i])
+		if err != nil {
+			return written, err
+		}
+		name := fixtureName(fixtureRedactor.redactPath(response.node), fixtureRedactor.redactPath(response.path), fixtureRedactor.redactQuery(response.query))
+		if err := ioutil.WriteFile(filepath.Join(recordDir, name), redacted, 0644); err != nil {
+			return written, err
+		}
+		level.Info(logger).Log("Event", "Recorded "+response.path+" as "+name)
+		written++
+	}
+	recorded.responses = nil
+	return written, nil
+}
+
+// Wrap the cluster transport for record or replay mode when either is enabled
+func fixtureTransport(next http.RoundTripper) http.RoundTripper {
+	if replayDir != "" {
+		return replayTransport{dir: replayDir}
+	}
+	if recordDir != "" {
+		return recordingTransport{next: next}
+	}
+	return next
+}
+
+// Keys whose values are node hostnames, optionally with port or erlang node prefix
+var REDACT_HOST_KEYS = [...]string{"hostname", "hostName", "host", "otpNode", "thisNode", "node", "nodeName"}
+
+// Keys whose values are bucket names
+var REDACT_BUCKET_KEYS = [...]string{"bucket", "bucketName", "sourceName", "sourceBucket", "targetBucket", "source"}
+
+var uuidPattern = regexp.MustCompile(`\b[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}\b`)
+
+var ipv4Pattern = regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\b`)
+
+/*
+* Replaces hostnames, uuids, bucket names and backup repository ids with consistent
+* pseudonyms. Known values are collected from well known keys of all responses first
+* and then replaced wherever they occur, so a bucket named in a log message or a host
+* used as a map key is rewritten the same way as the field holding it.
+ */
+type redactor struct {
+	mu           sync.Mutex
+	hosts        map[string]string
+	uuids        map[string]string
+	buckets      map[string]string
+	repositories map[string]string
+}
+
+func newRedactor() *redactor {
+	return &redactor{
+		hosts:        make(map[string]string),
+		uuids:        make(map[string]string),
+		buckets:      make(map[string]string),
+		repositories: make(map[string]string),
+	}
+}
+
+// Decode a response and collect the sensitive values in it
+func (r *redactor) parse(body []byte) (interface{}, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collect(doc, "")
+	return doc, nil
+}
+
+// Rewrite a parsed response with the pseudonyms collected so far
+func (r *redactor) redact(doc interface{}) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.MarshalIndent(r.replace(doc), "", "  ")
+}
+
+// Rewrite a request path or node, e.g. /pools/default/certificate/node/<host>:<port>
+func (r *redactor) redactPath(path string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.replaceString(path)
+}
+
+// Rewrite the values of a raw query string, encoded the way EMX builds queries
+func (r *redactor) redactQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil || query == "" {
+		return query
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range values {
+		for i, value := range values[key] {
+			values[key][i] = r.replaceString(value)
+		}
+	}
+	return values.Encode()
+}
+
+// Record sensitive values found under well known keys
+func (r *redactor) collect(doc interface{}, key string) {
+	switch value := doc.(type) {
+	case map[string]interface{}:
+		// bucket documents carry their name in "name" next to "bucketType"
+		if _, ok := value["bucketType"]; ok {
+			if name, ok := value["name"].(string); ok {
+				r.pseudonym(r.buckets, "bucket", name)
+			}
+		}
+		// backup repositories name their bucket in a nested {"bucket": {"name": ...}}
+		if name, ok := value["name"].(string); ok && key == "bucket" {
+			r.pseudonym(r.buckets, "bucket", name)
+		}
+		// backup repositories carry their id next to the plan, it is part of the taskHistory path
+		if _, ok := value["plan_name"]; ok {
+			if id, ok := value["id"].(string); ok && id != "" {
+				r.pseudonym(r.repositories, "repository", id)
+			}
+		}
+		// walk keys in order so pseudonyms are numbered the same on every run
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			// per node maps such as rebalanceProgress are keyed by erlang node name
+			if strings.HasPrefix(k, "ns_1@") {
+				r.pseudonym(r.hosts, "host", bareHost(k))
+			}
+			r.collect(value[k], k)
+		}
+	case []interface{}:
+		for _, v := range value {
+			r.collect(v, key)
+		}
+	case string:
+		for _, hostKey := range REDACT_HOST_KEYS {
+			if key == hostKey && value != "" {
+				r.pseudonym(r.hosts, "host", bareHost(value))
+			}
+		}
+		for _, bucketKey := range REDACT_BUCKET_KEYS {
+			if key == bucketKey && value != "" {
+				r.pseudonym(r.buckets, "bucket", value)
+			}
+		}
+		for _, ip := range ipv4Pattern.FindAllString(value, -1) {
+			r.pseudonym(r.hosts, "host", ip)
+		}
+	}
+}
+
+// Rewrite every string and map key using the collected pseudonyms
+func (r *redactor) replace(doc interface{}) interface{} {
+	switch value := doc.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			out[r.replaceString(k)] = r.replace(v)
+		}
+		return out
+	case []interface{}:
+		for i, v := range value {
+			value[i] = r.replace(v)
+		}
+		return value
+	case string:
+		return r.replaceString(value)
+	}
+	return doc
+}
+
+func (r *redactor) replaceString(value string) string {
+	if pseudonym, ok := r.buckets[value]; ok {
+		return pseudonym
+	}
+	for _, name := range sortedByLength(r.buckets) {
+		value = replaceName(value, name, r.buckets[name])
+	}
+	for _, id := range sortedByLength(r.repositories) {
+		value = replaceName(value, id, r.repositories[id])
+	}
+	for _, name := range sortedByLength(r.hosts) {
+		value = strings.ReplaceAll(value, name, r.hosts[name])
+	}
+	return uuidPattern.ReplaceAllStringFunc(value, func(uuid string) string {
+		return r.pseudonym(r.uuids, "uuid", uuid)
+	})
+}
+
+/*
+* Replace a name wherever it occurs as a whole word, e.g. in `Bucket "x" loaded` or in
+* the xdcr id "<uuid>/x/y". A bucket called "default" must not rewrite "_default"
+* scopes, "default-2" buckets or the fixed "/pools/default" path.
+ */
+func replaceName(value string, name string, pseudonym string) string {
+	var out strings.Builder
+	for {
+		i := strings.Index(value, name)
+		if i < 0 {
+			break
+		}
+		end := i + len(name)
+		if !isNameRune(lastRune(value[:i])) && !isNameRune(firstRune(value[end:])) && !strings.HasSuffix(value[:i], "/pools/") {
+			out.WriteString(value[:i])
+			out.WriteString(pseudonym)
+		} else {
+			out.WriteString(value[:end])
+		}
+		value = value[end:]
+	}
+	out.WriteString(value)
+	return out.String()
+}
+
+// Characters allowed in bucket names
+func isNameRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("._%-", c)
+}
+
+func firstRune(value string) rune {
+	for _, c := range value {
+		return c
+	}
+	return 0
+}
+
+func lastRune(value string) rune {
+	c, _ := utf8.DecodeLastRuneInString(value)
+	if c == utf8.RuneError {
+		return 0
+	}
+	return c
+}
+
+// Pseudonym for a value, allocating the next one of its kind on first use
+func (r *redactor) pseudonym(known map[string]string, kind string, value string) string {
+	if pseudonym, ok := known[value]; ok {
+		return pseudonym
+	}
+	var pseudonym string
+	if kind == "uuid" {
+		pseudonym = fmt.Sprintf("%032x", len(known)+1)
+	} else {
+		pseudonym = fmt.Sprintf("%s-%d", kind, len(known)+1)
+	}
+	known[value] = pseudonym
+	return pseudonym
+}
+
+// Longest first, so that "cb1.example.com" is not half replaced by "cb1"
+func sortedByLength(known map[string]string) []string {
+	keys := make([]string, 0, len(known))
+	for k := range known {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// Strip erlang node prefix and port, "ns_1@cb1.example.com:8091" -> "cb1.example.com"
+func bareHost(value string) string {
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		value = value[i+1:]
+	}
+	if strings.HasPrefix(value, "[") {
+		if i := strings.Index(value, "]"); i >= 0 {
+			return value[1:i]
+		}
+	}
+	if strings.Count(value, ":") == 1 {
+		value = strings.Split(value, ":")[0]
+	}
+	return value
+}
+
+/*
+* Run a single collection against the cluster so that every endpoint EMX
+* calls is recorded. Requires EnableRecording and a registered collector.
+ */
+func RecordFixtures(logger log.Logger) error {
+	if emxCollector == nil {
+		return fmt.Errorf("no collector registered, a client certificate or CB_USERNAME is required")
+	}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	written, err := writeFixtures()
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		return fmt.Errorf("no fixture recorded, the cluster returned no successful json response")
+	}
+	level.Info(logger).Log("Event", "Recorded "+strconv.Itoa(written)+" fixtures for "+strconv.Itoa(len(families))+" metric families into '"+recordDir+"'")
+	return nil
+}
@@ -0,0 +1,124 @@
+package couchbase
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/*
+* Answer cluster requests from the fixtures in testdata/<scenario> for the rest of the test.
+* Fixture files are named like recorded ones, see fixtureName.
+ */
+func replayFixtures(t *testing.T, scenario string) {
+	t.Helper()
+	replayDir = filepath.Join("testdata", scenario)
+	CB_CONNECTIONSTRING = "http://localhost:8091"
+	cbemxClient = newCbemxHttpClient(tls.Certificate{})
+	detected = nil
+	t.Cleanup(func() {
+		replayDir = ""
+		cbemxClient = nil
+		detected = nil
+	})
+}
+
+// A sub-collector as prometheus.Collector, collecting a new scrape every time
+type replayCollector struct {
+	subCollector
+}
+
+func (c replayCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range collectMetrics(c.subCollector, newScrape()) {
+		ch <- metric
+	}
+}
+
+// The named sub-collector, replaying the fixtures of a scenario
+func newReplayCollector(t *testing.T, scenario string, name string) replayCollector {
+	t.Helper()
+	replayFixtures(t, scenario)
+	return replayCollector{collectorRegistry[name].factory()}
+}
+
+func TestReplayQueryNodeSettings(t *testing.T) {
+	collector := newReplayCollector(t, "query_nodes", "query")
+
+	expected := `
+# HELP query_node_setting_drift The setting differs between query nodes 0/1 --> false/true.
+# TYPE query_node_setting_drift gauge
+query_node_setting_drift{cluster_uuid="00000000000000000000000000000001",setting="completed-limit"} 0
+query_node_setting_drift{cluster_uuid="00000000000000000000000000000001",setting="completed-threshold"} 0
+query_node_setting_drift{cluster_uuid="00000000000000000000000000000001",setting="max-parallelism"} 1
+query_node_setting_drift{cluster_uuid="00000000000000000000000000000001",setting="pipeline-batch"} 0
+query_node_setting_drift{cluster_uuid="00000000000000000000000000000001",setting="timeout"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "query_node_setting_drift"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFixtureNameKeepsServiceNodes(t *testing.T) {
+	for _, c := range []struct {
+		host     string
+		path     string
+		query    string
+		expected string
+	}{
+		{"localhost:8091", "/pools/default/buckets", "", "pools_default_buckets.json"},
+		{"host-1:8093", "/admin/settings", "", "host-1_8093_admin_settings.json"},
+		{"host-2:18093", "/admin/settings", "", "host-2_18093_admin_settings.json"},
+		{"host-1:8097", "/api/v1/cluster/self/repository/active/repository-1/taskHistory", "limit=1", "host-1_8097_api_v1_cluster_self_repository_active_repository-1_taskHistory_limit_1.json"},
+	} {
+		if name := fixtureName(fixtureNode(c.host), c.path, c.query); name != c.expected {
+			t.Errorf("fixture name for %s%s is %s, expected %s", c.host, c.path, name, c.expected)
+		}
+	}
+}
+
+func TestRedactBackupRepositories(t *testing.T) {
+	r := newRedactor()
+	doc, err := r.parse([]byte(`[{"id":"prod-orders-repo","plan_name":"daily","state":"active","bucket":{"name":"orders"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted, err := r.redact(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"prod-orders-repo", "orders"} {
+		if strings.Contains(string(redacted), secret) {
+			t.Errorf("%q not redacted in %s", secret, redacted)
+		}
+	}
+	if !strings.Contains(string(redacted), `"repository-1"`) || !strings.Contains(string(redacted), `"bucket-1"`) {
+		t.Errorf("missing pseudonyms in %s", redacted)
+	}
+
+	path := r.redactPath("/api/v1/cluster/self/repository/active/prod-orders-repo/taskHistory")
+	if path != "/api/v1/cluster/self/repository/active/repository-1/taskHistory" {
+		t.Errorf("repository id not redacted in path %s", path)
+	}
+}
+
+func TestRedactBucketNamesInText(t *testing.T) {
+	r := newRedactor()
+	if _, err := r.parse([]byte(`[{"name":"default","bucketType":"membase"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	for text, expected := range map[string]string{
+		`Bucket "default" loaded`:        `Bucket "bucket-1" loaded`,
+		"uuid/default/default":           "uuid/bucket-1/bucket-1",
+		"/pools/default/buckets/default": "/pools/default/buckets/bucket-1",
+		"_default":                       "_default",
+		"default-2":                      "default-2",
+	} {
+		if redacted := r.redactPath(text); redacted != expected {
+			t.Errorf("%q redacted to %q, expected %q", text, redacted, expected)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// /CBEMXENDPOINT_IndexStatus
+type cbemxIndexStatusArray struct {
+	Indexes []cbemxIndexStatusDetails `json:"indexes"`
+}
+
+// per index from CBEMXENDPOINT_IndexStatus
+type cbemxIndexStatusDetails struct {
+	NumReplicas int    `json:"numReplica"`
+	Definition  string `json:"definition"`
+	IndexName   string `json:"indexName"`
+	Bucket      string `json:"bucket"`
+	Collection  string `json:"collection"`
+	Scope       string `json:"scope"`
+	ReplicaId   int    `json:"replicaId"`
+}
+
+// indexStatus before 7.0, every index lives in the default collection
+func decodeIndexStatusWithoutCollections(body []byte, v interface{}) error {
+	status, ok := v.(*cbemxIndexStatusArray)
+	if !ok {
+		return fmt.Errorf("cannot decode indexStatus into %T", v)
+	}
+	if err := json.Unmarshal(body, status); err != nil {
+		return err
+	}
+	for i := range status.Indexes {
+		status.Indexes[i].Scope, status.Indexes[i].Collection = "_default", "_default"
+	}
+	return nil
+}
+
+// CBEMXENDPOINT_IndexSettings
+type cbemxIndexSettingsDetails struct {
+	StorageMode            string  `json:"storageMode"`
+	IndexerThreads         float64 `json:"indexerThreads"`
+	MemorySnapshotInterval float64 `json:"memorySnapshotInterval"`
+	StableSnapshotInterval float64 `json:"stableSnapshotInterval"`
+	MaxRollbackPoints      float64 `json:"maxRollbackPoints"`
+	LogLevel               string  `json:"logLevel"`
+	RedistributeIndexes    bool    `json:"redistributeIndexes"`
+	NumReplica             int     `json:"numReplica"`
+	EnablePageBloomFilter  bool    `json:"enablePageBloomFilter"`
+}
+
+// Label options for radio select metric streams
+var INDEX_STORAGE_ENGINES = [...]string{"memory_optimize", "plasma"}
+var INDEX_LOG_LEVELS = [...]string{"silent", "fatal", "error", "warn", "info", "verbose", "timing", "debug", "trace"}
+
+// Index inventory and index service settings
+type indexesCollector struct {
+	index_replica_count               *prometheus.Desc
+	index_storage_engine              *prometheus.Desc
+	index_indexer_threads             *prometheus.Desc
+	index_memory_snapshot_interval_ms *prometheus.Desc
+	index_stable_snapshot_interval_ms *prometheus.Desc
+	index_max_rollback_points         *prometheus.Desc
+	index_log_level                   *prometheus.Desc
+	index_redistribute_indexes        *prometheus.Desc
+	index_page_bloom_filter_enabled   *prometheus.Desc
+	index_default_replica_count       *prometheus.Desc
+	index_default_replica_missing     *prometheus.Desc
+}
+
+func init() {
+	registerCollector("indexes", true, newIndexesCollector)
+}
+
+func newIndexesCollector() subCollector {
+	return &indexesCollector{
+		index_replica_count: newEmxDesc("index_replica_count",
+			"The total number replicas for an index.",
+			[]string{"cluster_uuid", "bucket", "scope", "collection", "index_name", "index_type"},
+		),
+		index_storage_engine: newEmxDesc("index_storage_engine",
+			"Index Storage Engine type {memory optmized / plasma} selected state(1 - selected).",
+			[]string{"cluster_uuid", "index_engine"},
+		),
+		index_indexer_threads: newEmxDesc("index_indexer_threads",
+			"The number of indexer threads, 0 uses all cores.",
+			[]string{"cluster_uuid"},
+		),
+		index_memory_snapshot_interval_ms: newEmxDesc("index_memory_snapshot_interval_ms",
+			"The interval between in-memory index snapshots in ms.",
+			[]string{"cluster_uuid"},
+		),
+		index_stable_snapshot_interval_ms: newEmxDesc("index_stable_snapshot_interval_ms",
+			"The interval between persisted index snapshots in ms.",
+			[]string{"cluster_uuid"},
+		),
+		index_max_rollback_points: newEmxDesc("index_max_rollback_points",
+			"The maximum number of index rollback points.",
+			[]string{"cluster_uuid"},
+		),
+		index_log_level: newEmxDesc("index_log_level",
+			"Indexer log level {silent/fatal/error/warn/info/verbose/timing/debug/trace} selected state(1 - selected).",
+			[]string{"cluster_uuid", "level"},
+		),
+		index_redistribute_indexes: newEmxDesc("index_redistribute_indexes",
+			"Indexes are redistributed on rebalance 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		index_page_bloom_filter_enabled: newEmxDesc("index_page_bloom_filter_enabled",
+			"Page bloom filters for plasma indexes 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid"},
+		),
+		index_default_replica_count: newEmxDesc("index_default_replica_count",
+			"The default number of replicas for new indexes.",
+			[]string{"cluster_uuid"},
+		),
+		index_default_replica_missing: newEmxDesc("index_default_replica_missing",
+			"New indexes are created without replicas by default (default replicas < 1) 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+	}
+}
+
+func (collector *indexesCollector) Name() string {
+	return "indexes"
+}
+
+func (collector *indexesCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_IndexStatus, CBEMXENDPOINT_IndexSettings}
+}
+
+func (collector *indexesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.index_replica_count
+	ch <- collector.index_storage_engine
+	ch <- collector.index_indexer_threads
+	ch <- collector.index_memory_snapshot_interval_ms
+	ch <- collector.index_stable_snapshot_interval_ms
+	ch <- collector.index_max_rollback_points
+	ch <- collector.index_log_level
+	ch <- collector.index_redistribute_indexes
+	ch <- collector.index_page_bloom_filter_enabled
+	ch <- collector.index_default_replica_count
+	ch <- collector.index_default_replica_missing
+}
+
+func (collector *indexesCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		cbemxIndexStatusStructArray cbemxIndexStatusArray
+		cbemxIndexSettingsStruct    cbemxIndexSettingsDetails
+	)
+	if err := s.get(CBEMXENDPOINT_IndexSettings, &cbemxIndexSettingsStruct); err != nil {
+		return err
+	}
+	settings := cbemxIndexSettingsStruct
+	for _, option := range INDEX_STORAGE_ENGINES {
+		ch <- prometheus.MustNewConstMetric(collector.index_storage_engine, prometheus.GaugeValue, float64(boolVal(option == settings.StorageMode)), s.uuid, option)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.index_indexer_threads, prometheus.GaugeValue, settings.IndexerThreads, s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_memory_snapshot_interval_ms, prometheus.GaugeValue, settings.MemorySnapshotInterval, s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_stable_snapshot_interval_ms, prometheus.GaugeValue, settings.StableSnapshotInterval, s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_max_rollback_points, prometheus.GaugeValue, settings.MaxRollbackPoints, s.uuid)
+	for _, option := range INDEX_LOG_LEVELS {
+		ch <- prometheus.MustNewConstMetric(collector.index_log_level, prometheus.GaugeValue, float64(boolVal(option == strings.ToLower(settings.LogLevel))), s.uuid, option)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.index_redistribute_indexes, prometheus.GaugeValue, float64(boolVal(settings.RedistributeIndexes)), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_page_bloom_filter_enabled, prometheus.GaugeValue, float64(boolVal(settings.EnablePageBloomFilter)), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_default_replica_count, prometheus.GaugeValue, float64(settings.NumReplica), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.index_default_replica_missing, prometheus.GaugeValue, float64(boolVal(settings.NumReplica < 1)), s.uuid)
+
+	if err := s.getVersioned("index_status", &cbemxIndexStatusStructArray); err != nil {
+		return err
+	}
+	// per index metrics
+	for _, index := range cbemxIndexStatusStructArray.Indexes {
+		// skip replica index definitions due to redundancy
+		if index.ReplicaId != 0 {
+			continue
+		}
+		// _system indexes are skipped by the default scope filter
+		if !s.include("bucket", index.Bucket) || !s.include("scope", index.Scope) ||
+			!s.include("collection", index.Collection) || !s.include("index", index.IndexName) {
+			continue
+		}
+		var index_type = "secondary"
+		if strings.Contains(strings.ToLower(index.Definition), "create primary") {
+			index_type = "primary"
+		}
+		ch <- prometheus.MustNewConstMetric(collector.index_replica_count, prometheus.GaugeValue, float64(index.NumReplicas), s.uuid, index.Bucket, index.Scope, index.Collection, index.IndexName, index_type)
+	}
+	return nil
+}
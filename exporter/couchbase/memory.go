@@ -0,0 +1,133 @@
+package couchbase
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Share of node memory the service quotas of a node may take before it is flagged as overcommitted
+var memoryOvercommitPercent = 80.0
+
+// CBEMXENDPOINT_PoolsDefault, service memory quotas in MB
+type cbemxMemoryQuotaDetails struct {
+	MemoryQuota         float64 `json:"memoryQuota"`
+	IndexMemoryQuota    float64 `json:"indexMemoryQuota"`
+	FtsMemoryQuota      float64 `json:"ftsMemoryQuota"`
+	CbasMemoryQuota     float64 `json:"cbasMemoryQuota"`
+	EventingMemoryQuota float64 `json:"eventingMemoryQuota"`
+	QueryMemoryQuota    float64 `json:"queryMemoryQuota"` // from 7.6
+	StorageTotals       struct {
+		Ram struct {
+			QuotaTotal float64 `json:"quotaTotal"`
+			QuotaUsed  float64 `json:"quotaUsed"`
+		} `json:"ram"`
+	} `json:"storageTotals"`
+}
+
+// Quota in MB of each service as listed in CBEMXENDPOINT_ClusterStatus
+func (quotas cbemxMemoryQuotaDetails) serviceQuotas() map[string]float64 {
+	return map[string]float64{
+		"kv":       quotas.MemoryQuota,
+		"index":    quotas.IndexMemoryQuota,
+		"fts":      quotas.FtsMemoryQuota,
+		"cbas":     quotas.CbasMemoryQuota,
+		"eventing": quotas.EventingMemoryQuota,
+		"n1ql":     quotas.QueryMemoryQuota,
+	}
+}
+
+// Service memory quotas against node memory
+type memoryCollector struct {
+	service_memory_quota                *prometheus.Desc
+	node_memory_total_bytes             *prometheus.Desc
+	node_memory_quota_percent           *prometheus.Desc
+	node_memory_overcommitted           *prometheus.Desc
+	data_memory_quota_unallocated_bytes *prometheus.Desc
+}
+
+func init() {
+	registerCollector("memory", true, newMemoryCollector)
+	registerCollectorOptions("memory", func() {
+		flag.Float64Var(&memoryOvercommitPercent, "collector.memory.overcommit-percent", memoryOvercommitPercent, "Percent of node memory above which the quotas of the services on a node are flagged as overcommitted")
+	})
+}
+
+func newMemoryCollector() subCollector {
+	return &memoryCollector{
+		service_memory_quota: newEmxDesc("service_memory_quota",
+			"The memory quota of a service per node in MB.",
+			[]string{"cluster_uuid", "service"},
+		),
+		node_memory_total_bytes: newEmxDesc("node_memory_total_bytes",
+			"The physical memory of a node in bytes.",
+			[]string{"cluster_uuid", "node"},
+		),
+		node_memory_quota_percent: newEmxDesc("node_memory_quota_percent",
+			"The sum of the quotas of the services on a node in percent of its physical memory.",
+			[]string{"cluster_uuid", "node"},
+		),
+		node_memory_overcommitted: newEmxDesc("node_memory_overcommitted",
+			"The quotas of the services on a node exceed --collector.memory.overcommit-percent of its memory 0/1 --> false/true.",
+			[]string{"cluster_uuid", "node"},
+		),
+		data_memory_quota_unallocated_bytes: newEmxDesc("data_memory_quota_unallocated_bytes",
+			"The Data service memory quota not allocated to buckets, summed over the data nodes, in bytes.",
+			[]string{"cluster_uuid"},
+		),
+	}
+}
+
+func (collector *memoryCollector) Name() string {
+	return "memory"
+}
+
+func (collector *memoryCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_PoolsDefault, CBEMXENDPOINT_ClusterStatus}
+}
+
+func (collector *memoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.service_memory_quota
+	ch <- collector.node_memory_total_bytes
+	ch <- collector.node_memory_quota_percent
+	ch <- collector.node_memory_overcommitted
+	ch <- collector.data_memory_quota_unallocated_bytes
+}
+
+func (collector *memoryCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		cbemxMemoryQuotaStruct   cbemxMemoryQuotaDetails
+		cbemxClusterStatusStruct cbemxClusterStatusDetails
+	)
+	if err := s.get(CBEMXENDPOINT_PoolsDefault, &cbemxMemoryQuotaStruct); err != nil {
+		return err
+	}
+	quotas := cbemxMemoryQuotaStruct.serviceQuotas()
+	for _, service := range CLUSTER_SERVICES {
+		if quota, ok := quotas[service]; ok {
+			ch <- prometheus.MustNewConstMetric(collector.service_memory_quota, prometheus.GaugeValue, quota, s.uuid, service)
+		}
+	}
+	var ram = cbemxMemoryQuotaStruct.StorageTotals.Ram
+	ch <- prometheus.MustNewConstMetric(collector.data_memory_quota_unallocated_bytes, prometheus.GaugeValue, ram.QuotaTotal-ram.QuotaUsed, s.uuid)
+
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return err
+	}
+	for _, node := range cbemxClusterStatusStruct.Nodes {
+		var hostname = strings.Split(node.Hostname, ":")[0]
+		ch <- prometheus.MustNewConstMetric(collector.node_memory_total_bytes, prometheus.GaugeValue, node.MemoryTotal, s.uuid, hostname)
+		if node.MemoryTotal <= 0 {
+			continue
+		}
+		var quotaSum float64
+		for _, service := range node.Services {
+			quotaSum += quotas[service]
+		}
+		var percent = quotaSum * 1024 * 1024 / node.MemoryTotal * 100
+		ch <- prometheus.MustNewConstMetric(collector.node_memory_quota_percent, prometheus.GaugeValue, percent, s.uuid, hostname)
+		ch <- prometheus.MustNewConstMetric(collector.node_memory_overcommitted, prometheus.GaugeValue, float64(boolVal(percent > memoryOvercommitPercent)), s.uuid, hostname)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package couchbase
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_QuesrySettings
+type cbemxQuerySettingsDetails struct {
+	Slow_queries_threshold int     `json:"queryCompletedThreshold"`
+	Slow_queries_limit     int     `json:"queryCompletedLimit"`
+	TmpSpaceDir            string  `json:"queryTmpSpaceDir"`
+	TmpSpaceSize           float64 `json:"queryTmpSpaceSize"`
+	PipelineBatch          float64 `json:"queryPipelineBatch"`
+	PipelineCap            float64 `json:"queryPipelineCap"`
+	ScanCap                float64 `json:"queryScanCap"`
+	Timeout                float64 `json:"queryTimeout"`
+	PreparedLimit          float64 `json:"queryPreparedLimit"`
+	MaxParallelism         float64 `json:"queryMaxParallelism"`
+	N1QLFeatCtrl           float64 `json:"queryN1QLFeatCtrl"`
+	MemoryQuota            float64 `json:"queryMemoryQuota"`
+	NumAtrs                float64 `json:"queryNumAtrs"`
+	CleanupClientAttempts  bool    `json:"queryCleanupClientAttempts"`
+	CleanupLostAttempts    bool    `json:"queryCleanupLostAttempts"`
+	CleanupWindow          string  `json:"queryCleanupWindow"`
+}
+
+// CBEMXENDPOINT_QueryCurlAllowlist
+type cbemxQueryCurlAllowlistDetails struct {
+	AllAccess      bool     `json:"all_access"`
+	AllowedUrls    []string `json:"allowed_urls"`
+	DisallowedUrls []string `json:"disallowed_urls"`
+}
+
+// Numeric settings from CBEMXENDPOINT_QueryNodeSettings compared across query nodes
+var QUERY_NODE_SETTINGS = [...]string{"completed-limit", "completed-threshold", "max-parallelism", "memory-quota", "n1ql-feat-ctrl", "numatrs", "pipeline-batch", "pipeline-cap", "prepared-limit", "scan-cap", "servicers", "timeout"}
+
+// Label options for radio select metric streams
+var QUERY_CURL_ACCESS = [...]string{"all", "restricted", "none"}
+
+// Query service settings
+type queryCollector struct {
+	slow_queries_threshold        *prometheus.Desc
+	slow_queries_limit            *prometheus.Desc
+	query_tmp_space_dir_info      *prometheus.Desc
+	query_tmp_space_size          *prometheus.Desc
+	query_pipeline_batch          *prometheus.Desc
+	query_pipeline_cap            *prometheus.Desc
+	query_scan_cap                *prometheus.Desc
+	query_timeout                 *prometheus.Desc
+	query_prepared_limit          *prometheus.Desc
+	query_max_parallelism         *prometheus.Desc
+	query_n1ql_feat_ctrl          *prometheus.Desc
+	query_memory_quota            *prometheus.Desc
+	query_num_atrs                *prometheus.Desc
+	query_cleanup_client_attempts *prometheus.Desc
+	query_cleanup_lost_attempts   *prometheus.Desc
+	query_cleanup_window_seconds  *prometheus.Desc
+	query_curl_access             *prometheus.Desc
+	query_curl_allowed_urls       *prometheus.Desc
+	query_node_setting            *prometheus.Desc
+	query_node_setting_drift      *prometheus.Desc
+}
+
+func init() {
+	registerCollector("query", true, newQueryCollector)
+}
+
+func newQueryCollector() subCollector {
+	return &queryCollector{
+		slow_queries_threshold: newEmxDesc("slow_queries_threshold",
+			"The threshold for mimnimum query duration in ms for slow query logging.",
+			[]string{"cluster_uuid"},
+		),
+		slow_queries_limit: newEmxDesc("slow_queries_limit",
+			"Retention limit for slow query logging.",
+			[]string{"cluster_uuid"},
+		),
+		query_tmp_space_dir_info: newEmxDesc("query_tmp_space_dir_info",
+			"The directory for temporary query data, always 1.",
+			[]string{"cluster_uuid", "dir"},
+		),
+		query_tmp_space_size: newEmxDesc("query_tmp_space_size",
+			"The maximum size of temporary query data in MB, 0 unlimited, -1 disabled.",
+			[]string{"cluster_uuid"},
+		),
+		query_pipeline_batch: newEmxDesc("query_pipeline_batch",
+			"The number of items execution operators can batch.",
+			[]string{"cluster_uuid"},
+		),
+		query_pipeline_cap: newEmxDesc("query_pipeline_cap",
+			"The maximum number of items each execution operator can buffer.",
+			[]string{"cluster_uuid"},
+		),
+		query_scan_cap: newEmxDesc("query_scan_cap",
+			"The maximum buffered channel size between the indexer and the query service.",
+			[]string{"cluster_uuid"},
+		),
+		query_timeout: newEmxDesc("query_timeout",
+			"The maximum time to spend on a query in ns, 0 no timeout.",
+			[]string{"cluster_uuid"},
+		),
+		query_prepared_limit: newEmxDesc("query_prepared_limit",
+			"The maximum number of prepared statements in the cache.",
+			[]string{"cluster_uuid"},
+		),
+		query_max_parallelism: newEmxDesc("query_max_parallelism",
+			"The maximum number of index partitions for parallel aggregation.",
+			[]string{"cluster_uuid"},
+		),
+		query_n1ql_feat_ctrl: newEmxDesc("query_n1ql_feat_ctrl",
+			"The N1QL feature control bitmask.",
+			[]string{"cluster_uuid"},
+		),
+		query_memory_quota: newEmxDesc("query_memory_quota",
+			"The memory quota per query request in MB, 0 no quota.",
+			[]string{"cluster_uuid"},
+		),
+		query_num_atrs: newEmxDesc("query_num_atrs",
+			"The number of active transaction records.",
+			[]string{"cluster_uuid"},
+		),
+		query_cleanup_client_attempts: newEmxDesc("query_cleanup_client_attempts",
+			"Cleanup of transaction attempts created by the query service 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid"},
+		),
+		query_cleanup_lost_attempts: newEmxDesc("query_cleanup_lost_attempts",
+			"Cleanup of lost transaction attempts 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid"},
+		),
+		query_cleanup_window_seconds: newEmxDesc("query_cleanup_window_seconds",
+			"The window within which expired transactions are cleaned up in seconds.",
+			[]string{"cluster_uuid"},
+		),
+		query_curl_access: newEmxDesc("query_curl_access",
+			"The CURL() access {all/restricted/none} selected state(1 - selected).",
+			[]string{"cluster_uuid", "access"},
+		),
+		query_curl_allowed_urls: newEmxDesc("query_curl_allowed_urls",
+			"The number of URLs on the CURL() allowlist.",
+			[]string{"cluster_uuid"},
+		),
+		query_node_setting: newEmxDesc("query_node_setting",
+			"The value of a setting on a query node.",
+			[]string{"cluster_uuid", "node", "setting"},
+		),
+		query_node_setting_drift: newEmxDesc("query_node_setting_drift",
+			"The setting differs between query nodes 0/1 --> false/true.",
+			[]string{"cluster_uuid", "setting"},
+		),
+	}
+}
+
+func (collector *queryCollector) Name() string {
+	return "query"
+}
+
+func (collector *queryCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_QuesrySettings, CBEMXENDPOINT_QueryCurlAllowlist, CBEMXENDPOINT_ClusterStatus, ":8093" + CBEMXENDPOINT_QueryNodeSettings}
+}
+
+func (collector *queryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.slow_queries_threshold
+	ch <- collector.slow_queries_limit
+	ch <- collector.query_tmp_space_dir_info
+	ch <- collector.query_tmp_space_size
+	ch <- collector.query_pipeline_batch
+	ch <- collector.query_pipeline_cap
+	ch <- collector.query_scan_cap
+	ch <- collector.query_timeout
+	ch <- collector.query_prepared_limit
+	ch <- collector.query_max_parallelism
+	ch <- collector.query_n1ql_feat_ctrl
+	ch <- collector.query_memory_quota
+	ch <- collector.query_num_atrs
+	ch <- collector.query_cleanup_client_attempts
+	ch <- collector.query_cleanup_lost_attempts
+	ch <- collector.query_cleanup_window_seconds
+	ch <- collector.query_curl_access
+	ch <- collector.query_curl_allowed_urls
+	ch <- collector.query_node_setting
+	ch <- collector.query_node_setting_drift
+}
+
+func (collector *queryCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                     []error
+		cbemxQuerySettingsStruct cbemxQuerySettingsDetails
+		cbemxCurlAllowlistStruct cbemxQueryCurlAllowlistDetails
+	)
+	if err := s.get(CBEMXENDPOINT_QuesrySettings, &cbemxQuerySettingsStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		settings := cbemxQuerySettingsStruct
+		ch <- prometheus.MustNewConstMetric(collector.slow_queries_threshold, prometheus.GaugeValue, float64(settings.Slow_queries_threshold), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.slow_queries_limit, prometheus.GaugeValue, float64(settings.Slow_queries_limit), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_tmp_space_dir_info, prometheus.GaugeValue, 1, s.uuid, settings.TmpSpaceDir)
+		ch <- prometheus.MustNewConstMetric(collector.query_tmp_space_size, prometheus.GaugeValue, settings.TmpSpaceSize, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_pipeline_batch, prometheus.GaugeValue, settings.PipelineBatch, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_pipeline_cap, prometheus.GaugeValue, settings.PipelineCap, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_scan_cap, prometheus.GaugeValue, settings.ScanCap, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_timeout, prometheus.GaugeValue, settings.Timeout, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_prepared_limit, prometheus.GaugeValue, settings.PreparedLimit, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_max_parallelism, prometheus.GaugeValue, settings.MaxParallelism, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_n1ql_feat_ctrl, prometheus.GaugeValue, settings.N1QLFeatCtrl, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_memory_quota, prometheus.GaugeValue, settings.MemoryQuota, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_num_atrs, prometheus.GaugeValue, settings.NumAtrs, s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_cleanup_client_attempts, prometheus.GaugeValue, float64(boolVal(settings.CleanupClientAttempts)), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.query_cleanup_lost_attempts, prometheus.GaugeValue, float64(boolVal(settings.CleanupLostAttempts)), s.uuid)
+		if window, err := time.ParseDuration(settings.CleanupWindow); err == nil {
+			ch <- prometheus.MustNewConstMetric(collector.query_cleanup_window_seconds, prometheus.GaugeValue, window.Seconds(), s.uuid)
+		}
+	}
+
+	if err := s.get(CBEMXENDPOINT_QueryCurlAllowlist, &cbemxCurlAllowlistStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		var access = "none"
+		if cbemxCurlAllowlistStruct.AllAccess {
+			access = "all"
+		} else if len(cbemxCurlAllowlistStruct.AllowedUrls) > 0 {
+			access = "restricted"
+		}
+		for _, option := range QUERY_CURL_ACCESS {
+			ch <- prometheus.MustNewConstMetric(collector.query_curl_access, prometheus.GaugeValue, float64(boolVal(option == access)), s.uuid, option)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.query_curl_allowed_urls, prometheus.GaugeValue, float64(len(cbemxCurlAllowlistStruct.AllowedUrls)), s.uuid)
+	}
+
+	// per query node settings, which can be changed on a node without changing the cluster settings
+	var nodeValues = make(map[string]map[string]bool)
+	for _, hostname := range s.serviceNodes("n1ql") {
+		var nodeSettings map[string]interface{}
+		if err := s.getService(hostname, "n1ql", CBEMXENDPOINT_QueryNodeSettings, &nodeSettings); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var node = strings.Split(hostname, ":")[0]
+		for _, setting := range QUERY_NODE_SETTINGS {
+			var value float64
+			switch v := nodeSettings[setting].(type) {
+			case float64:
+				value = v
+			case bool:
+				value = float64(boolVal(v))
+			default:
+				continue
+			}
+			if nodeValues[setting] == nil {
+				nodeValues[setting] = make(map[string]bool)
+			}
+			nodeValues[setting][fmt.Sprint(value)] = true
+			ch <- prometheus.MustNewConstMetric(collector.query_node_setting, prometheus.GaugeValue, value, s.uuid, node, setting)
+		}
+	}
+	var settings []string
+	for setting := range nodeValues {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		ch <- prometheus.MustNewConstMetric(collector.query_node_setting_drift, prometheus.GaugeValue, float64(boolVal(len(nodeValues[setting]) > 1)), s.uuid, setting)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,174 @@
+package couchbase
+
+import (
+	"errors"
+	"flag"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Per user from CBEMXENDPOINT_RbacUsers
+type cbemxRbacUserDetails struct {
+	Id                 string `json:"id"`
+	Domain             string `json:"domain"`
+	PasswordChangeDate string `json:"password_change_date"`
+	Roles              []struct {
+		Role       string `json:"role"`
+		BucketName string `json:"bucket_name"`
+	} `json:"roles"`
+	Groups []string `json:"groups"`
+}
+
+// Per group from CBEMXENDPOINT_RbacGroups
+type cbemxRbacGroupDetails struct {
+	Id string `json:"id"`
+}
+
+// Label options for radio select metric streams
+var RBAC_DOMAINS = [...]string{"local", "external"}
+
+/*
+* RBAC user and role inventory.
+* rbac_user_info has one series per user, disable it with --no-collector.rbac.user-info on clusters with many users.
+ */
+type rbacCollector struct {
+	rbac_users_per_role                *prometheus.Desc
+	rbac_users_per_domain              *prometheus.Desc
+	rbac_admin_users                   *prometheus.Desc
+	rbac_users_without_password_change *prometheus.Desc
+	rbac_group_count                   *prometheus.Desc
+	rbac_user_info                     *prometheus.Desc
+}
+
+// Whether rbac_user_info is exported, --collector.rbac.user-info and --no-collector.rbac.user-info
+var rbacUserInfo, rbacNoUserInfo = true, false
+
+func init() {
+	registerCollector("rbac", true, newRbacCollector)
+	registerCollectorOptions("rbac", func() {
+		flag.BoolVar(&rbacUserInfo, "collector.rbac.user-info", true, "Export rbac_user_info with one series per user")
+		flag.BoolVar(&rbacNoUserInfo, "no-collector.rbac.user-info", false, "Do not export rbac_user_info, e.g. on clusters with many users")
+	})
+}
+
+func newRbacCollector() subCollector {
+	return &rbacCollector{
+		rbac_users_per_role: newEmxDesc("rbac_users_per_role",
+			"The number of users holding a role, directly or through a group.",
+			[]string{"cluster_uuid", "role"},
+		),
+		rbac_users_per_domain: newEmxDesc("rbac_users_per_domain",
+			"The number of users per domain {local/external}.",
+			[]string{"cluster_uuid", "domain"},
+		),
+		rbac_admin_users: newEmxDesc("rbac_admin_users",
+			"The number of users with the full admin role.",
+			[]string{"cluster_uuid"},
+		),
+		rbac_users_without_password_change: newEmxDesc("rbac_users_without_password_change",
+			"The number of local users whose password was never changed.",
+			[]string{"cluster_uuid"},
+		),
+		rbac_group_count: newEmxDesc("rbac_group_count",
+			"The number of user groups.",
+			[]string{"cluster_uuid"},
+		),
+		rbac_user_info: newEmxDesc("rbac_user_info",
+			"User with domain and comma separated roles, always 1.",
+			[]string{"cluster_uuid", "user", "domain", "roles"},
+		),
+	}
+}
+
+func (collector *rbacCollector) Name() string {
+	return "rbac"
+}
+
+func (collector *rbacCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_RbacUsers, CBEMXENDPOINT_RbacGroups}
+}
+
+func (collector *rbacCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.rbac_users_per_role
+	ch <- collector.rbac_users_per_domain
+	ch <- collector.rbac_admin_users
+	ch <- collector.rbac_users_without_password_change
+	ch <- collector.rbac_group_count
+	ch <- collector.rbac_user_info
+}
+
+func (collector *rbacCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                 []error
+		cbemxRbacUsersArray  []cbemxRbacUserDetails
+		cbemxRbacGroupsArray []cbemxRbacGroupDetails
+	)
+
+	if err := s.get(CBEMXENDPOINT_RbacUsers, &cbemxRbacUsersArray); err != nil {
+		errs = append(errs, err)
+	} else {
+		var (
+			usersPerRole   = make(map[string]int)
+			usersPerDomain = make(map[string]int)
+			adminUsers     = 0
+			noPassChange   = 0
+		)
+		for _, user := range cbemxRbacUsersArray {
+			usersPerDomain[user.Domain]++
+			if user.Domain == "local" && user.PasswordChangeDate == "" {
+				noPassChange++
+			}
+			// a role granted on several buckets or also through a group counts once per user
+			var (
+				roles     = make(map[string]bool)
+				roleNames []string
+			)
+			for _, role := range user.Roles {
+				var name = role.Role
+				if role.BucketName != "" && role.BucketName != "*" {
+					name += "[" + role.BucketName + "]"
+				}
+				if !roles[role.Role] {
+					usersPerRole[role.Role]++
+					roles[role.Role] = true
+				}
+				roleNames = appendUnique(roleNames, name)
+			}
+			if roles["admin"] {
+				adminUsers++
+			}
+			sort.Strings(roleNames)
+			if rbacUserInfo && !rbacNoUserInfo {
+				ch <- prometheus.MustNewConstMetric(collector.rbac_user_info, prometheus.GaugeValue, 1, s.uuid, user.Id, user.Domain, strings.Join(roleNames, ","))
+			}
+		}
+		for role, count := range usersPerRole {
+			ch <- prometheus.MustNewConstMetric(collector.rbac_users_per_role, prometheus.GaugeValue, float64(count), s.uuid, role)
+		}
+		for _, domain := range RBAC_DOMAINS {
+			ch <- prometheus.MustNewConstMetric(collector.rbac_users_per_domain, prometheus.GaugeValue, float64(usersPerDomain[domain]), s.uuid, domain)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.rbac_admin_users, prometheus.GaugeValue, float64(adminUsers), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.rbac_users_without_password_change, prometheus.GaugeValue, float64(noPassChange), s.uuid)
+	}
+
+	if err := s.get(CBEMXENDPOINT_RbacGroups, &cbemxRbacGroupsArray); err != nil {
+		errs = append(errs, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.rbac_group_count, prometheus.GaugeValue, float64(len(cbemxRbacGroupsArray)), s.uuid)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Append a value unless already present
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
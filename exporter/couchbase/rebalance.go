@@ -0,0 +1,211 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/**
+** CBEMXENDPOINT_Rebalance
+**
+** Rebalance Status json response structure:
+** {
+**  "status": "running",
+**  "<hostname>": {
+**    "progress": <float>
+** },
+**  "<hostname>": {
+**    "progress": <float>
+**  }
+**}
+**/
+type cbemxRebalanceDetails struct {
+	Status          string                     `json:"status"`
+	ProgressDetails map[string]json.RawMessage `json:"-"`
+}
+
+// Per node entry of CBEMXENDPOINT_Rebalance
+type cbemxRebalanceNodeDetails struct {
+	Progress float64 `json:"progress"`
+}
+
+// Overall progress seen at the previous poll of a running rebalance
+type rebalanceProgress struct {
+	progress float64
+	time     time.Time
+}
+
+// Rebalance counters and progress
+type rebalanceCollector struct {
+	rebalance_start_counter                          *prometheus.Desc
+	rebalance_success_counter                        *prometheus.Desc
+	rebalance_fail_counter                           *prometheus.Desc
+	rebalance_stop_counter                           *prometheus.Desc
+	rebalance_status                                 *prometheus.Desc
+	rebalance_running                                *prometheus.Desc
+	rebalance_progress                               *prometheus.Desc
+	rebalance_progress_rate                          *prometheus.Desc
+	rebalance_estimated_completion_timestamp_seconds *prometheus.Desc
+	// progress at the previous poll for the rate, nil when no rebalance was running
+	previous *rebalanceProgress
+}
+
+func init() {
+	registerCollector("rebalance", true, newRebalanceCollector)
+}
+
+func newRebalanceCollector() subCollector {
+	return &rebalanceCollector{
+		rebalance_start_counter: newEmxDesc("rebalance_start_counter",
+			"The total number of rebalances started.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_success_counter: newEmxDesc("rebalance_success_counter",
+			"The total number of rebalances completed successfully.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_fail_counter: newEmxDesc("rebalance_fail_counter",
+			"The total number of rebalances that failed.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_stop_counter: newEmxDesc("rebalance_stop_counter",
+			"The total number of rebalances stopped before completion.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_status: newEmxDesc("rebalance_status",
+			"The current rebalance progress per node.",
+			[]string{"cluster_uuid", "node", "services"},
+		),
+		rebalance_running: newEmxDesc("rebalance_running",
+			"A rebalance is running 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_progress: newEmxDesc("rebalance_progress",
+			"The overall progress in percent of the running rebalance.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_progress_rate: newEmxDesc("rebalance_progress_rate",
+			"The overall progress of the running rebalance in percent per second since the previous poll.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_estimated_completion_timestamp_seconds: newEmxDesc("rebalance_estimated_completion_timestamp_seconds",
+			"The estimated completion time of the running rebalance at the current rate in seconds since epoch.",
+			[]string{"cluster_uuid"},
+		),
+	}
+}
+
+func (collector *rebalanceCollector) Name() string {
+	return "rebalance"
+}
+
+func (collector *rebalanceCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus, CBEMXENDPOINT_Rebalance, CBEMXENDPOINT_Tasks}
+}
+
+func (collector *rebalanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.rebalance_start_counter
+	ch <- collector.rebalance_success_counter
+	ch <- collector.rebalance_fail_counter
+	ch <- collector.rebalance_stop_counter
+	ch <- collector.rebalance_status
+	ch <- collector.rebalance_running
+	ch <- collector.rebalance_progress
+	ch <- collector.rebalance_progress_rate
+	ch <- collector.rebalance_estimated_completion_timestamp_seconds
+}
+
+func (collector *rebalanceCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		cbemxClusterStatusStruct cbemxClusterStatusDetails
+		cbemxRebalanceStruct     cbemxRebalanceDetails
+	)
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return err
+	}
+	counters := cbemxClusterStatusStruct.Counters
+
+	// Rebalance
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_start_counter, prometheus.CounterValue, float64(counters.Rebalance_start), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_success_counter, prometheus.CounterValue, float64(counters.Rebalance_success), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_fail_counter, prometheus.CounterValue, float64(counters.Rebalance_fail), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_stop_counter, prometheus.CounterValue, float64(counters.Rebalance_stop), s.uuid)
+
+	if err := s.get(CBEMXENDPOINT_Rebalance, &cbemxRebalanceStruct.ProgressDetails); err != nil {
+		return err
+	}
+	nodes := s.nodeServices()
+	var (
+		nodeCount     int
+		nodesProgress float64
+	)
+	for host, details := range cbemxRebalanceStruct.ProgressDetails {
+		// "status" is the only key that is not a node
+		if host == "status" {
+			if err := json.Unmarshal(details, &cbemxRebalanceStruct.Status); err != nil {
+				level.Error(logger).Log("Error", "Unexpected rebalance status "+string(details))
+			}
+			continue
+		}
+		var nodeDetails cbemxRebalanceNodeDetails
+		if err := json.Unmarshal(details, &nodeDetails); err != nil {
+			level.Error(logger).Log("Error", "Unexpected rebalance progress for "+host+": "+err.Error())
+			continue
+		}
+		nodeCount++
+		nodesProgress += nodeDetails.Progress
+		// host is the erlang node name "ns_1@<hostname>", bareHost also copes without the prefix
+		var services string = strings.Join(nodes[bareHost(host)], ",")
+		ch <- prometheus.MustNewConstMetric(collector.rebalance_status, prometheus.GaugeValue, nodeDetails.Progress, s.uuid, host, services)
+	}
+
+	// the rebalance task carries the overall progress, its per service stage
+	// progress is exported by the tasks collector as task_rebalance_stage_progress
+	var (
+		cbemxTasksArray []cbemxTaskDetails
+		rebalanceTask   *cbemxTaskDetails
+	)
+	if err := s.get(CBEMXENDPOINT_Tasks, &cbemxTasksArray); err != nil {
+		level.Error(logger).Log("Error", "No rebalance task progress: "+err.Error())
+	}
+	for i, task := range cbemxTasksArray {
+		if task.Type == "rebalance" {
+			rebalanceTask = &cbemxTasksArray[i]
+		}
+	}
+
+	var running = cbemxRebalanceStruct.Status == "running" || (rebalanceTask != nil && rebalanceTask.Status == "running")
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_running, prometheus.GaugeValue, float64(boolVal(running)), s.uuid)
+	if !running {
+		collector.previous = nil
+		return nil
+	}
+
+	var progress float64
+	if rebalanceTask != nil && rebalanceTask.Status == "running" && rebalanceTask.Progress != nil {
+		progress = *rebalanceTask.Progress
+	} else if nodeCount > 0 {
+		// per node progress is a fraction
+		progress = nodesProgress / float64(nodeCount) * 100
+	}
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_progress, prometheus.GaugeValue, progress, s.uuid)
+
+	// rate and estimate need a previous poll of the same rebalance
+	var now = time.Now()
+	var previous = collector.previous
+	collector.previous = &rebalanceProgress{progress: progress, time: now}
+	if previous == nil || progress < previous.progress {
+		return nil
+	}
+	var rate = (progress - previous.progress) / now.Sub(previous.time).Seconds()
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_progress_rate, prometheus.GaugeValue, rate, s.uuid)
+	if rate > 0 {
+		var remaining = time.Duration((100 - progress) / rate * float64(time.Second))
+		ch <- prometheus.MustNewConstMetric(collector.rebalance_estimated_completion_timestamp_seconds, prometheus.GaugeValue, float64(now.Add(remaining).Unix()), s.uuid)
+	}
+	return nil
+}
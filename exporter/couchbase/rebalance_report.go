@@ -0,0 +1,156 @@
+package couchbase
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_RebalanceReport, the report of the last rebalance
+type cbemxRebalanceReportDetails struct {
+	RebalanceId       string                                      `json:"rebalanceId"`
+	CompletionMessage string                                      `json:"completionMessage"`
+	CompletionTime    string                                      `json:"completionTime"`
+	StageInfo         map[string]cbemxRebalanceReportStageDetails `json:"stageInfo"`
+}
+
+// Per service stage of the rebalance report
+type cbemxRebalanceReportStageDetails struct {
+	TimeTaken float64 `json:"timeTaken"` // ms
+	// data stage: per bucket vBucket moves, index stage: one entry per moved index
+	Details map[string]struct {
+		VbucketLevelInfo struct {
+			Move struct {
+				TotalCount float64 `json:"totalCount"`
+			} `json:"move"`
+		} `json:"vbucketLevelInfo"`
+	} `json:"details"`
+}
+
+// Stage and moves of the last rebalance report
+type rebalanceReportCollector struct {
+	rebalance_report_stage_duration_seconds       *prometheus.Desc
+	rebalance_report_moved_vbuckets               *prometheus.Desc
+	rebalance_report_moved_indexes                *prometheus.Desc
+	rebalance_report_completion_status            *prometheus.Desc
+	rebalance_report_completion_timestamp_seconds *prometheus.Desc
+	rebalance_report_info                         *prometheus.Desc
+}
+
+func init() {
+	registerCollector("rebalance_report", true, newRebalanceReportCollector)
+}
+
+func newRebalanceReportCollector() subCollector {
+	return &rebalanceReportCollector{
+		rebalance_report_stage_duration_seconds: newEmxDesc("rebalance_report_stage_duration_seconds",
+			"The duration of a service stage of the last rebalance in seconds.",
+			[]string{"cluster_uuid", "stage"},
+		),
+		rebalance_report_moved_vbuckets: newEmxDesc("rebalance_report_moved_vbuckets",
+			"The number of vBuckets of a bucket moved by the last rebalance.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+		rebalance_report_moved_indexes: newEmxDesc("rebalance_report_moved_indexes",
+			"The number of indexes moved by the last rebalance.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_report_completion_status: newEmxDesc("rebalance_report_completion_status",
+			"The result of the last rebalance report {success/failed/stopped} selected state(1 - selected).",
+			[]string{"cluster_uuid", "status"},
+		),
+		rebalance_report_completion_timestamp_seconds: newEmxDesc("rebalance_report_completion_timestamp_seconds",
+			"The time the last rebalance report was completed in seconds since epoch.",
+			[]string{"cluster_uuid"},
+		),
+		rebalance_report_info: newEmxDesc("rebalance_report_info",
+			"The id and completion message of the last rebalance report, always 1.",
+			[]string{"cluster_uuid", "rebalance_id", "message"},
+		),
+	}
+}
+
+func (collector *rebalanceReportCollector) Name() string {
+	return "rebalance_report"
+}
+
+func (collector *rebalanceReportCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_RebalanceReport}
+}
+
+func (collector *rebalanceReportCollector) requiredCapability() string {
+	return "rebalance_report_stages"
+}
+
+func (collector *rebalanceReportCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.rebalance_report_stage_duration_seconds
+	ch <- collector.rebalance_report_moved_vbuckets
+	ch <- collector.rebalance_report_moved_indexes
+	ch <- collector.rebalance_report_completion_status
+	ch <- collector.rebalance_report_completion_timestamp_seconds
+	ch <- collector.rebalance_report_info
+}
+
+func (collector *rebalanceReportCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxRebalanceReportStruct cbemxRebalanceReportDetails
+	if err := s.get(CBEMXENDPOINT_RebalanceReport, &cbemxRebalanceReportStruct); err != nil {
+		return err
+	}
+	report := cbemxRebalanceReportStruct
+
+	var stages []string
+	for stage := range report.StageInfo {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		info := report.StageInfo[stage]
+		ch <- prometheus.MustNewConstMetric(collector.rebalance_report_stage_duration_seconds, prometheus.GaugeValue, info.TimeTaken/1000, s.uuid, stage)
+		switch stage {
+		case "data":
+			for bucket, details := range info.Details {
+				if !s.include("bucket", bucket) {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(collector.rebalance_report_moved_vbuckets, prometheus.GaugeValue, details.VbucketLevelInfo.Move.TotalCount, s.uuid, bucket)
+			}
+		case "index":
+			ch <- prometheus.MustNewConstMetric(collector.rebalance_report_moved_indexes, prometheus.GaugeValue, float64(len(info.Details)), s.uuid)
+		}
+	}
+
+	// the completion message reads like the UI log, e.g. "Rebalance completed successfully."
+	status, _ := classifyLogText(report.CompletionMessage)
+	for _, option := range REBALANCE_RESULTS {
+		ch <- prometheus.MustNewConstMetric(collector.rebalance_report_completion_status, prometheus.GaugeValue, float64(boolVal(option == status)), s.uuid, option)
+	}
+	if completed, err := time.Parse(time.RFC3339, report.CompletionTime); err == nil {
+		ch <- prometheus.MustNewConstMetric(collector.rebalance_report_completion_timestamp_seconds, prometheus.GaugeValue, float64(completed.Unix()), s.uuid)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.rebalance_report_info, prometheus.GaugeValue, 1, s.uuid, report.RebalanceId, report.CompletionMessage)
+	return nil
+}
+
+/*
+* Serves the full report of the last rebalance as json, fetched from the cluster on every request.
+* Independent of /metrics scrapes, the connection string and client are set up at startup.
+ */
+func RebalanceReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cbemxClient == nil {
+			http.Error(w, "no client certificate or credentials for the cluster", http.StatusServiceUnavailable)
+			return
+		}
+		report, err := getCbemxBytes(CB_CONNECTIONSTRING + CBEMXENDPOINT_RebalanceReport)
+		if err != nil {
+			level.Error(logger).Log("Error", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(report)
+	})
+}
@@ -0,0 +1,188 @@
+package couchbase
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_SearchIndexes
+type cbemxSearchIndexesDetails struct {
+	IndexDefs struct {
+		IndexDefs map[string]cbemxSearchIndexDefDetails `json:"indexDefs"`
+	} `json:"indexDefs"`
+}
+
+// per index definition from CBEMXENDPOINT_SearchIndexes
+type cbemxSearchIndexDefDetails struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	SourceType string `json:"sourceType"`
+	SourceName string `json:"sourceName"`
+	PlanParams struct {
+		IndexPartitions int `json:"indexPartitions"`
+		NumReplicas     int `json:"numReplicas"`
+	} `json:"planParams"`
+}
+
+// CBEMXENDPOINT_SearchCfg, only the partition plan is decoded
+type cbemxSearchCfgDetails struct {
+	PlanPIndexes struct {
+		PlanPIndexes map[string]struct {
+			IndexName string `json:"indexName"`
+		} `json:"planPIndexes"`
+	} `json:"planPIndexes"`
+}
+
+// Label options for radio select metric streams
+var FTS_SOURCE_TYPES = [...]string{"gocbcore", "couchbase"}
+var FTS_INDEX_MISMATCHES = [...]string{"no_replicas", "replicas_exceed_nodes", "unplanned_partitions"}
+
+// Full text search index inventory and configuration
+type searchCollector struct {
+	fts_index_count              *prometheus.Desc
+	fts_index_partitions         *prometheus.Desc
+	fts_index_planned_partitions *prometheus.Desc
+	fts_index_replica_count      *prometheus.Desc
+	fts_index_source_type        *prometheus.Desc
+	fts_index_doc_count          *prometheus.Desc
+	fts_index_mismatch           *prometheus.Desc
+}
+
+func init() {
+	registerCollector("search", true, newSearchCollector)
+}
+
+func newSearchCollector() subCollector {
+	var indexLabels = []string{"cluster_uuid", "bucket", "index_name"}
+	return &searchCollector{
+		fts_index_count: newEmxDesc("fts_index_count",
+			"The number of search indexes on a bucket.",
+			[]string{"cluster_uuid", "bucket"},
+		),
+		fts_index_partitions: newEmxDesc("fts_index_partitions",
+			"The number of partitions defined for a search index.",
+			indexLabels,
+		),
+		fts_index_planned_partitions: newEmxDesc("fts_index_planned_partitions",
+			"The number of partitions of a search index in the current plan.",
+			indexLabels,
+		),
+		fts_index_replica_count: newEmxDesc("fts_index_replica_count",
+			"The number of replicas defined for a search index.",
+			indexLabels,
+		),
+		fts_index_source_type: newEmxDesc("fts_index_source_type",
+			"Search index source type {gocbcore/couchbase} selected state(1 - selected).",
+			append(indexLabels, "source_type"),
+		),
+		fts_index_doc_count: newEmxDesc("fts_index_doc_count",
+			"The number of documents in a search index summed over all search nodes.",
+			indexLabels,
+		),
+		fts_index_mismatch: newEmxDesc("fts_index_mismatch",
+			"Search index definition does not fit the cluster {no_replicas/replicas_exceed_nodes/unplanned_partitions} 0/1 --> false/true.",
+			append(indexLabels, "mismatch"),
+		),
+	}
+}
+
+func (collector *searchCollector) Name() string {
+	return "search"
+}
+
+func (collector *searchCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus, ":8094" + CBEMXENDPOINT_SearchIndexes, ":8094" + CBEMXENDPOINT_SearchStats, ":8094" + CBEMXENDPOINT_SearchCfg}
+}
+
+func (collector *searchCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.fts_index_count
+	ch <- collector.fts_index_partitions
+	ch <- collector.fts_index_planned_partitions
+	ch <- collector.fts_index_replica_count
+	ch <- collector.fts_index_source_type
+	ch <- collector.fts_index_doc_count
+	ch <- collector.fts_index_mismatch
+}
+
+func (collector *searchCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                     []error
+		cbemxSearchIndexesStruct cbemxSearchIndexesDetails
+		cbemxSearchCfgStruct     cbemxSearchCfgDetails
+	)
+	var ftsNodes = s.serviceNodes("fts")
+	if len(ftsNodes) == 0 {
+		return nil
+	}
+	// index definitions and the plan are cluster wide, any search node serves them
+	if err := s.getAnyService(ftsNodes, "fts", CBEMXENDPOINT_SearchIndexes, &cbemxSearchIndexesStruct); err != nil {
+		return err
+	}
+	var plannedPartitions = make(map[string]int)
+	if err := s.getAnyService(ftsNodes, "fts", CBEMXENDPOINT_SearchCfg, &cbemxSearchCfgStruct); err != nil {
+		errs = append(errs, err)
+	}
+	for _, pindex := range cbemxSearchCfgStruct.PlanPIndexes.PlanPIndexes {
+		plannedPartitions[pindex.IndexName]++
+	}
+
+	// stats are per node and keyed "<bucket>:<index>:<stat>"
+	var docCounts = make(map[string]float64)
+	for _, hostname := range ftsNodes {
+		var stats map[string]interface{}
+		if err := s.getService(hostname, "fts", CBEMXENDPOINT_SearchStats, &stats); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for key, value := range stats {
+			parts := strings.Split(key, ":")
+			if count, ok := value.(float64); ok && len(parts) == 3 && parts[2] == "doc_count" {
+				docCounts[parts[1]] += count
+			}
+		}
+	}
+
+	var names []string
+	for name := range cbemxSearchIndexesStruct.IndexDefs.IndexDefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var indexCounts = make(map[string]int)
+	for _, name := range names {
+		index := cbemxSearchIndexesStruct.IndexDefs.IndexDefs[name]
+		// aliases have no partitions of their own
+		if index.Type != "fulltext-index" {
+			continue
+		}
+		if !s.include("bucket", index.SourceName) || !s.include("index", index.Name) {
+			continue
+		}
+		indexCounts[index.SourceName]++
+		var labels = []string{s.uuid, index.SourceName, index.Name}
+		var plan = index.PlanParams
+		ch <- prometheus.MustNewConstMetric(collector.fts_index_partitions, prometheus.GaugeValue, float64(plan.IndexPartitions), labels...)
+		ch <- prometheus.MustNewConstMetric(collector.fts_index_planned_partitions, prometheus.GaugeValue, float64(plannedPartitions[index.Name]), labels...)
+		ch <- prometheus.MustNewConstMetric(collector.fts_index_replica_count, prometheus.GaugeValue, float64(plan.NumReplicas), labels...)
+		for _, option := range FTS_SOURCE_TYPES {
+			ch <- prometheus.MustNewConstMetric(collector.fts_index_source_type, prometheus.GaugeValue, float64(boolVal(option == index.SourceType)), append(labels, option)...)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.fts_index_doc_count, prometheus.GaugeValue, docCounts[index.Name], labels...)
+
+		var mismatches = map[string]bool{
+			"no_replicas":           plan.NumReplicas == 0 && len(ftsNodes) > 1,
+			"replicas_exceed_nodes": plan.NumReplicas >= len(ftsNodes),
+			"unplanned_partitions":  len(cbemxSearchCfgStruct.PlanPIndexes.PlanPIndexes) > 0 && plannedPartitions[index.Name] < plan.IndexPartitions,
+		}
+		for _, option := range FTS_INDEX_MISMATCHES {
+			ch <- prometheus.MustNewConstMetric(collector.fts_index_mismatch, prometheus.GaugeValue, float64(boolVal(mismatches[option])), append(labels, option)...)
+		}
+	}
+	for bucket, count := range indexCounts {
+		ch <- prometheus.MustNewConstMetric(collector.fts_index_count, prometheus.GaugeValue, float64(count), s.uuid, bucket)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,228 @@
+package couchbase
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_SecuritySettings
+type cbemxSecuritySettingsDetails struct {
+	TlsMinVersion          string   `json:"tlsMinVersion"`
+	CipherSuites           []string `json:"cipherSuites"`
+	HonorCipherOrder       bool     `json:"honorCipherOrder"`
+	ClusterEncryptionLevel string   `json:"clusterEncryptionLevel"`
+	DisableUIOverHttp      bool     `json:"disableUIOverHttp"`
+	DisableUIOverHttps     bool     `json:"disableUIOverHttps"`
+}
+
+// CBEMXENDPOINT_PoolsDefault, node encryption per node
+type cbemxPoolsDefaultEncryptionDetails struct {
+	Nodes []struct {
+		Hostname       string `json:"hostname"`
+		NodeEncryption bool   `json:"nodeEncryption"`
+	} `json:"nodes"`
+}
+
+// CBEMXENDPOINT_ClientCertAuth
+type cbemxClientCertAuthDetails struct {
+	State string `json:"state"`
+}
+
+// CBEMXENDPOINT_PasswordPolicy
+type cbemxPasswordPolicyDetails struct {
+	MinLength           int  `json:"minLength"`
+	EnforceUppercase    bool `json:"enforceUppercase"`
+	EnforceLowercase    bool `json:"enforceLowercase"`
+	EnforceDigits       bool `json:"enforceDigits"`
+	EnforceSpecialChars bool `json:"enforceSpecialChars"`
+}
+
+// CBEMXENDPOINT_Audit
+type cbemxAuditDetails struct {
+	AuditdEnabled bool `json:"auditdEnabled"`
+}
+
+// Label options for radio select metric streams
+var SECURITY_TLS_VERSIONS = [...]string{"tlsv1", "tlsv1.1", "tlsv1.2", "tlsv1.3"}
+var SECURITY_ENCRYPTION_LEVELS = [...]string{"none", "control", "all", "strict"}
+var SECURITY_CLIENT_CERT_STATES = [...]string{"disable", "enable", "mandatory"}
+var SECURITY_PASSWORD_RULES = [...]string{"uppercase", "lowercase", "digits", "special_chars"}
+
+// Cluster security posture
+type securityCollector struct {
+	security_tls_min_version          *prometheus.Desc
+	security_cipher_suites_count      *prometheus.Desc
+	security_honor_cipher_order       *prometheus.Desc
+	security_cluster_encryption_level *prometheus.Desc
+	security_node_encryption_enabled  *prometheus.Desc
+	security_ui_http_disabled         *prometheus.Desc
+	security_ui_http_only             *prometheus.Desc
+	security_client_cert_auth_state   *prometheus.Desc
+	security_password_min_length      *prometheus.Desc
+	security_password_policy_enforced *prometheus.Desc
+	security_password_policy_strength *prometheus.Desc
+	security_audit_enabled            *prometheus.Desc
+}
+
+func init() {
+	registerCollector("security", true, newSecurityCollector)
+}
+
+func newSecurityCollector() subCollector {
+	return &securityCollector{
+		security_tls_min_version: newEmxDesc("security_tls_min_version",
+			"The minimum TLS version {tlsv1/tlsv1.1/tlsv1.2/tlsv1.3} selected state(1 - selected).",
+			[]string{"cluster_uuid", "tls_version"},
+		),
+		security_cipher_suites_count: newEmxDesc("security_cipher_suites_count",
+			"The number of explicitly configured cipher suites, 0 when the default cipher suites are used.",
+			[]string{"cluster_uuid"},
+		),
+		security_honor_cipher_order: newEmxDesc("security_honor_cipher_order",
+			"Server cipher suite order preferred 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		security_cluster_encryption_level: newEmxDesc("security_cluster_encryption_level",
+			"The cluster encryption level {none/control/all/strict} selected state(1 - selected).",
+			[]string{"cluster_uuid", "level"},
+		),
+		security_node_encryption_enabled: newEmxDesc("security_node_encryption_enabled",
+			"Node to node encryption state per node 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid", "node"},
+		),
+		security_ui_http_disabled: newEmxDesc("security_ui_http_disabled",
+			"The UI over plain HTTP state 0/1 --> enabled/disabled.",
+			[]string{"cluster_uuid"},
+		),
+		security_ui_http_only: newEmxDesc("security_ui_http_only",
+			"The UI is only served over plain HTTP 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		security_client_cert_auth_state: newEmxDesc("security_client_cert_auth_state",
+			"The client certificate authentication state {disable/enable/mandatory} selected state(1 - selected).",
+			[]string{"cluster_uuid", "state"},
+		),
+		security_password_min_length: newEmxDesc("security_password_min_length",
+			"The minimum password length of the password policy.",
+			[]string{"cluster_uuid"},
+		),
+		security_password_policy_enforced: newEmxDesc("security_password_policy_enforced",
+			"The password policy rule {uppercase/lowercase/digits/special_chars} enforced state 0/1 --> false/true.",
+			[]string{"cluster_uuid", "rule"},
+		),
+		security_password_policy_strength: newEmxDesc("security_password_policy_strength",
+			"The number of character classes enforced by the password policy (0-4).",
+			[]string{"cluster_uuid"},
+		),
+		security_audit_enabled: newEmxDesc("security_audit_enabled",
+			"The audit log state 0/1 --> disabled/enabled.",
+			[]string{"cluster_uuid"},
+		),
+	}
+}
+
+func (collector *securityCollector) Name() string {
+	return "security"
+}
+
+func (collector *securityCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_SecuritySettings, CBEMXENDPOINT_PoolsDefault, CBEMXENDPOINT_ClientCertAuth, CBEMXENDPOINT_PasswordPolicy, CBEMXENDPOINT_Audit}
+}
+
+func (collector *securityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.security_tls_min_version
+	ch <- collector.security_cipher_suites_count
+	ch <- collector.security_honor_cipher_order
+	ch <- collector.security_cluster_encryption_level
+	ch <- collector.security_node_encryption_enabled
+	ch <- collector.security_ui_http_disabled
+	ch <- collector.security_ui_http_only
+	ch <- collector.security_client_cert_auth_state
+	ch <- collector.security_password_min_length
+	ch <- collector.security_password_policy_enforced
+	ch <- collector.security_password_policy_strength
+	ch <- collector.security_audit_enabled
+}
+
+/*
+* Each security endpoint is read independently, some need more than ro_admin on
+* older versions and a failing endpoint should not hide the others.
+ */
+func (collector *securityCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                      []error
+		cbemxSecuritySettings     cbemxSecuritySettingsDetails
+		cbemxPoolsDefaultStruct   cbemxPoolsDefaultEncryptionDetails
+		cbemxClientCertAuthStruct cbemxClientCertAuthDetails
+		cbemxPasswordPolicyStruct cbemxPasswordPolicyDetails
+		cbemxAuditStruct          cbemxAuditDetails
+	)
+
+	// node encryption decides between "none" and the configured level
+	var nodeEncryption = false
+	if err := s.get(CBEMXENDPOINT_PoolsDefault, &cbemxPoolsDefaultStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, node := range cbemxPoolsDefaultStruct.Nodes {
+			var hostname = strings.Split(node.Hostname, ":")[0]
+			nodeEncryption = nodeEncryption || node.NodeEncryption
+			ch <- prometheus.MustNewConstMetric(collector.security_node_encryption_enabled, prometheus.GaugeValue, float64(boolVal(node.NodeEncryption)), s.uuid, hostname)
+		}
+	}
+
+	if err := s.get(CBEMXENDPOINT_SecuritySettings, &cbemxSecuritySettings); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, option := range SECURITY_TLS_VERSIONS {
+			ch <- prometheus.MustNewConstMetric(collector.security_tls_min_version, prometheus.GaugeValue, float64(boolVal(option == cbemxSecuritySettings.TlsMinVersion)), s.uuid, option)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.security_cipher_suites_count, prometheus.GaugeValue, float64(len(cbemxSecuritySettings.CipherSuites)), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.security_honor_cipher_order, prometheus.GaugeValue, float64(boolVal(cbemxSecuritySettings.HonorCipherOrder)), s.uuid)
+
+		var encryptionLevel = "none"
+		if nodeEncryption {
+			encryptionLevel = cbemxSecuritySettings.ClusterEncryptionLevel
+		}
+		for _, option := range SECURITY_ENCRYPTION_LEVELS {
+			ch <- prometheus.MustNewConstMetric(collector.security_cluster_encryption_level, prometheus.GaugeValue, float64(boolVal(option == encryptionLevel)), s.uuid, option)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.security_ui_http_disabled, prometheus.GaugeValue, float64(boolVal(cbemxSecuritySettings.DisableUIOverHttp)), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.security_ui_http_only, prometheus.GaugeValue, float64(boolVal(!cbemxSecuritySettings.DisableUIOverHttp && cbemxSecuritySettings.DisableUIOverHttps)), s.uuid)
+	}
+
+	if err := s.get(CBEMXENDPOINT_ClientCertAuth, &cbemxClientCertAuthStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, option := range SECURITY_CLIENT_CERT_STATES {
+			ch <- prometheus.MustNewConstMetric(collector.security_client_cert_auth_state, prometheus.GaugeValue, float64(boolVal(option == cbemxClientCertAuthStruct.State)), s.uuid, option)
+		}
+	}
+
+	if err := s.get(CBEMXENDPOINT_PasswordPolicy, &cbemxPasswordPolicyStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		var enforced = map[string]bool{
+			"uppercase":     cbemxPasswordPolicyStruct.EnforceUppercase,
+			"lowercase":     cbemxPasswordPolicyStruct.EnforceLowercase,
+			"digits":        cbemxPasswordPolicyStruct.EnforceDigits,
+			"special_chars": cbemxPasswordPolicyStruct.EnforceSpecialChars,
+		}
+		var strength = 0
+		for _, rule := range SECURITY_PASSWORD_RULES {
+			strength += int(boolVal(enforced[rule]))
+			ch <- prometheus.MustNewConstMetric(collector.security_password_policy_enforced, prometheus.GaugeValue, float64(boolVal(enforced[rule])), s.uuid, rule)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.security_password_min_length, prometheus.GaugeValue, float64(cbemxPasswordPolicyStruct.MinLength), s.uuid)
+		ch <- prometheus.MustNewConstMetric(collector.security_password_policy_strength, prometheus.GaugeValue, float64(strength), s.uuid)
+	}
+
+	if err := s.get(CBEMXENDPOINT_Audit, &cbemxAuditStruct); err != nil {
+		errs = append(errs, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.security_audit_enabled, prometheus.GaugeValue, float64(boolVal(cbemxAuditStruct.AuditdEnabled)), s.uuid)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package couchbase
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// per group from CBEMXENDPOINT_ServerGroups
+type cbemxServerGroupDetails struct {
+	Name  string             `json:"name"`
+	Nodes []cbemxNodeDetails `json:"nodes"`
+}
+
+// CBEMXENDPOINT_ServerGroups
+type cbemxServerGroupsArray struct {
+	Groups []cbemxServerGroupDetails `json:"groups"`
+}
+
+// Server group layout
+type serverGroupsCollector struct {
+	server_group_count                *prometheus.Desc
+	largest_server_group_count        *prometheus.Desc
+	smallest_server_group_count       *prometheus.Desc
+	server_group_imbalance_ratio      *prometheus.Desc
+	server_group_node_count           *prometheus.Desc
+	server_group_service_node_count   *prometheus.Desc
+	server_group_without_data_service *prometheus.Desc
+}
+
+func init() {
+	registerCollector("server_groups", true, newServerGroupsCollector)
+}
+
+func newServerGroupsCollector() subCollector {
+	return &serverGroupsCollector{
+		server_group_count: newEmxDesc("server_group_count",
+			"Number of server groups in the cluster.",
+			[]string{"cluster_uuid"},
+		),
+		largest_server_group_count: newEmxDesc("largest_server_group_count",
+			"Size of largest server group in the cluster.",
+			[]string{"cluster_uuid"},
+		),
+		smallest_server_group_count: newEmxDesc("smallest_server_group_count",
+			"Size of smallest server group in the cluster.",
+			[]string{"cluster_uuid"},
+		),
+		server_group_imbalance_ratio: newEmxDesc("server_group_imbalance_ratio",
+			"Size of the largest server group divided by the size of the smallest, 1 when balanced.",
+			[]string{"cluster_uuid"},
+		),
+		server_group_node_count: newEmxDesc("server_group_node_count",
+			"Number of nodes in a server group.",
+			[]string{"cluster_uuid", "group"},
+		),
+		server_group_service_node_count: newEmxDesc("server_group_service_node_count",
+			"Number of nodes in a server group running a service.",
+			[]string{"cluster_uuid", "group", "service"},
+		),
+		server_group_without_data_service: newEmxDesc("server_group_without_data_service",
+			"The server group has no data service node, so replicas cannot be placed group aware 0/1 --> false/true.",
+			[]string{"cluster_uuid", "group"},
+		),
+	}
+}
+
+func (collector *serverGroupsCollector) Name() string {
+	return "server_groups"
+}
+
+func (collector *serverGroupsCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ServerGroups}
+}
+
+func (collector *serverGroupsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.server_group_count
+	ch <- collector.largest_server_group_count
+	ch <- collector.smallest_server_group_count
+	ch <- collector.server_group_imbalance_ratio
+	ch <- collector.server_group_node_count
+	ch <- collector.server_group_service_node_count
+	ch <- collector.server_group_without_data_service
+}
+
+func (collector *serverGroupsCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxServerGroupStruct cbemxServerGroupsArray
+	if err := s.get(CBEMXENDPOINT_ServerGroups, &cbemxServerGroupStruct); err != nil {
+		return err
+	}
+
+	// services running anywhere in the cluster, so every group reports every service
+	var services []string
+	for _, group := range cbemxServerGroupStruct.Groups {
+		for _, node := range group.Nodes {
+			for _, service := range node.Services {
+				services = appendUnique(services, service)
+			}
+		}
+	}
+	sort.Strings(services)
+
+	// count nodes per group
+	var largest_server_group_count, smallest_server_group_count = 0, -1
+	for _, group := range cbemxServerGroupStruct.Groups {
+		var tmpCount = len(group.Nodes)
+		if tmpCount > largest_server_group_count {
+			largest_server_group_count = tmpCount
+		}
+		if smallest_server_group_count < 0 || tmpCount < smallest_server_group_count {
+			smallest_server_group_count = tmpCount
+		}
+		ch <- prometheus.MustNewConstMetric(collector.server_group_node_count, prometheus.GaugeValue, float64(tmpCount), s.uuid, group.Name)
+
+		var serviceCounts = make(map[string]int)
+		for _, node := range group.Nodes {
+			for _, service := range node.Services {
+				serviceCounts[service]++
+			}
+		}
+		for _, service := range services {
+			ch <- prometheus.MustNewConstMetric(collector.server_group_service_node_count, prometheus.GaugeValue, float64(serviceCounts[service]), s.uuid, group.Name, service)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.server_group_without_data_service, prometheus.GaugeValue, float64(boolVal(serviceCounts["kv"] == 0)), s.uuid, group.Name)
+	}
+	if smallest_server_group_count < 0 {
+		smallest_server_group_count = 0
+	}
+
+	ch <- prometheus.MustNewConstMetric(collector.server_group_count, prometheus.GaugeValue, float64(len(cbemxServerGroupStruct.Groups)), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.largest_server_group_count, prometheus.GaugeValue, float64(largest_server_group_count), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.smallest_server_group_count, prometheus.GaugeValue, float64(smallest_server_group_count), s.uuid)
+	// an empty group makes the ratio meaningless, smallest_server_group_count shows it
+	if smallest_server_group_count > 0 {
+		ch <- prometheus.MustNewConstMetric(collector.server_group_imbalance_ratio, prometheus.GaugeValue, float64(largest_server_group_count)/float64(smallest_server_group_count), s.uuid)
+	}
+	return nil
+}
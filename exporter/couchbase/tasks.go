@@ -0,0 +1,195 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"flag"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Number of polls at the same progress after which a running task is reported as stuck
+var taskStuckPolls = 5
+
+// Per task from CBEMXENDPOINT_Tasks, shared with the xdcr and rebalance collectors
+type cbemxTaskDetails struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Id      string `json:"id"`
+	Status  string `json:"status"`
+	Bucket  string `json:"bucket"`
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	// missing for tasks without a measurable progress such as warming_up and loadingSampleBucket
+	Progress *float64 `json:"progress"`
+	// xdcr replications report outstanding mutations instead of a progress
+	ChangesLeft float64                          `json:"changesLeft"`
+	DocsChecked float64                          `json:"docsChecked"`
+	Errors      json.RawMessage                  `json:"errors"`
+	StageInfo   map[string]cbemxTaskStageDetails `json:"stageInfo"`
+}
+
+// Per service stage of a rebalance task
+type cbemxTaskStageDetails struct {
+	TotalProgress float64         `json:"totalProgress"`
+	StartTime     json.RawMessage `json:"startTime"`
+	CompletedTime json.RawMessage `json:"completedTime"`
+}
+
+// Label options for radio select metric streams
+var TASK_REBALANCE_SUBTYPES = [...]string{"rebalance", "gracefulFailover", "failover"}
+
+// Progress of a running task seen at the previous polls
+type taskProgress struct {
+	progress float64
+	// polls in a row that saw this progress, including the first
+	polls int
+}
+
+// Ongoing tasks such as compaction, index builds, xdcr replications, warmup and sample bucket loading
+type tasksCollector struct {
+	task_running                  *prometheus.Desc
+	task_progress                 *prometheus.Desc
+	task_stuck                    *prometheus.Desc
+	task_rebalance_subtype        *prometheus.Desc
+	task_rebalance_stage_progress *prometheus.Desc
+	// progress per type and bucket across polls for stuck detection
+	previous map[string]*taskProgress
+}
+
+func init() {
+	registerCollector("tasks", true, newTasksCollector)
+	registerCollectorOptions("tasks", func() {
+		flag.IntVar(&taskStuckPolls, "collector.tasks.stuck-polls", taskStuckPolls, "Polls without progress after which a running task is flagged as stuck")
+	})
+}
+
+func newTasksCollector() subCollector {
+	return &tasksCollector{
+		task_running: newEmxDesc("task_running",
+			"The number of running tasks per type and bucket, per replication for xdcr tasks with the source bucket as bucket.",
+			[]string{"cluster_uuid", "type", "bucket", "replication", "target"},
+		),
+		task_progress: newEmxDesc("task_progress",
+			"The average progress in percent of the running tasks per type and bucket reporting a progress, the share of checked mutations for xdcr tasks.",
+			[]string{"cluster_uuid", "type", "bucket", "replication", "target"},
+		),
+		task_stuck: newEmxDesc("task_stuck",
+			"Running tasks of the type and bucket made no progress across the configured number of polls 0/1 --> false/true.",
+			[]string{"cluster_uuid", "type", "bucket", "replication", "target"},
+		),
+		task_rebalance_subtype: newEmxDesc("task_rebalance_subtype",
+			"The running rebalance task subtype {rebalance/gracefulFailover/failover} selected state(1 - selected).",
+			[]string{"cluster_uuid", "subtype"},
+		),
+		task_rebalance_stage_progress: newEmxDesc("task_rebalance_stage_progress",
+			"The rebalance progress in percent per service stage.",
+			[]string{"cluster_uuid", "stage"},
+		),
+		previous: make(map[string]*taskProgress),
+	}
+}
+
+func (collector *tasksCollector) Name() string {
+	return "tasks"
+}
+
+func (collector *tasksCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_Tasks}
+}
+
+func (collector *tasksCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.task_running
+	ch <- collector.task_progress
+	ch <- collector.task_stuck
+	ch <- collector.task_rebalance_subtype
+	ch <- collector.task_rebalance_stage_progress
+}
+
+func (collector *tasksCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxTasksArray []cbemxTaskDetails
+	if err := s.get(CBEMXENDPOINT_Tasks, &cbemxTasksArray); err != nil {
+		return err
+	}
+
+	type taskKey struct {
+		taskType    string
+		bucket      string
+		replication string
+		target      string
+	}
+	var (
+		running  = make(map[taskKey]int)
+		progress = make(map[taskKey]float64)
+		// running tasks that reported a progress
+		reported = make(map[taskKey]int)
+	)
+	for _, task := range cbemxTasksArray {
+		if task.Status != "running" {
+			continue
+		}
+		key := taskKey{taskType: task.Type, bucket: task.Bucket}
+		var taskProgress = task.Progress
+		// one series per replication of the source bucket, progress from the mutations checked so far
+		if task.Type == "xdcr" {
+			key = taskKey{task.Type, task.Source, task.Id, task.Target}
+			var checked float64 = 100
+			if task.ChangesLeft > 0 {
+				checked = 100 * task.DocsChecked / (task.DocsChecked + task.ChangesLeft)
+			}
+			taskProgress = &checked
+		}
+		if key.bucket != "" && !s.include("bucket", key.bucket) {
+			continue
+		}
+		running[key]++
+		if taskProgress != nil {
+			reported[key]++
+			progress[key] += *taskProgress
+		}
+
+		if task.Type == "rebalance" {
+			for _, option := range TASK_REBALANCE_SUBTYPES {
+				ch <- prometheus.MustNewConstMetric(collector.task_rebalance_subtype, prometheus.GaugeValue, float64(boolVal(option == task.Subtype)), s.uuid, option)
+			}
+			for stage, info := range task.StageInfo {
+				ch <- prometheus.MustNewConstMetric(collector.task_rebalance_stage_progress, prometheus.GaugeValue, info.TotalProgress, s.uuid, stage)
+			}
+		}
+	}
+
+	var seen = make(map[string]bool)
+	for key, count := range running {
+		var labels = []string{s.uuid, key.taskType, key.bucket, key.replication, key.target}
+		ch <- prometheus.MustNewConstMetric(collector.task_running, prometheus.GaugeValue, float64(count), labels...)
+		// tasks without a progress can't be told stuck
+		if reported[key] == 0 {
+			ch <- prometheus.MustNewConstMetric(collector.task_stuck, prometheus.GaugeValue, 0, labels...)
+			continue
+		}
+		var average = progress[key] / float64(reported[key])
+		ch <- prometheus.MustNewConstMetric(collector.task_progress, prometheus.GaugeValue, average, labels...)
+
+		// stuck when the progress did not move for taskStuckPolls polls in a row,
+		// a replication that caught up stays at 100 and is idle rather than stuck
+		var id = key.taskType + "/" + key.bucket + "/" + key.replication
+		seen[id] = true
+		previous, ok := collector.previous[id]
+		if !ok {
+			previous = &taskProgress{progress: average, polls: 1}
+			collector.previous[id] = previous
+		} else if previous.progress == average {
+			previous.polls++
+		} else {
+			previous.progress = average
+			previous.polls = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.task_stuck, prometheus.GaugeValue, float64(boolVal(previous.polls >= taskStuckPolls && average < 100)), labels...)
+	}
+	// forget tasks that finished
+	for id := range collector.previous {
+		if !seen[id] {
+			delete(collector.previous, id)
+		}
+	}
+	return nil
+}
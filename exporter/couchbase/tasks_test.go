@@ -0,0 +1,30 @@
+package couchbase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTaskWithoutProgressIsNotStuck(t *testing.T) {
+	taskStuckPolls = 2
+	t.Cleanup(func() { taskStuckPolls = 5 })
+	collector := newReplayCollector(t, "tasks", "tasks")
+	testutil.CollectAndCount(collector)
+
+	expected := `
+# HELP task_progress The average progress in percent of the running tasks per type and bucket reporting a progress, the share of checked mutations for xdcr tasks.
+# TYPE task_progress gauge
+task_progress{bucket="bucket-2",cluster_uuid="00000000000000000000000000000001",replication="",target="",type="bucket_compaction"} 50
+task_progress{bucket="bucket-2",cluster_uuid="00000000000000000000000000000001",replication="0000000000000000000000000000000a/bucket-2/bucket-3",target="/remoteClusters/0000000000000000000000000000000a/buckets/bucket-3",type="xdcr"} 100
+# HELP task_stuck Running tasks of the type and bucket made no progress across the configured number of polls 0/1 --> false/true.
+# TYPE task_stuck gauge
+task_stuck{bucket="bucket-1",cluster_uuid="00000000000000000000000000000001",replication="",target="",type="warming_up"} 0
+task_stuck{bucket="bucket-2",cluster_uuid="00000000000000000000000000000001",replication="",target="",type="bucket_compaction"} 1
+task_stuck{bucket="bucket-2",cluster_uuid="00000000000000000000000000000001",replication="0000000000000000000000000000000a/bucket-2/bucket-3",target="/remoteClusters/0000000000000000000000000000000a/buckets/bucket-3",type="xdcr"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "task_progress", "task_stuck"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,111 @@
+package couchbase
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Services as listed in CBEMXENDPOINT_ClusterStatus
+var CLUSTER_SERVICES = [...]string{"kv", "index", "n1ql", "fts", "cbas", "eventing", "backup"}
+
+// Service placement across the nodes, multi dimensional scaling (MDS) layout
+type topologyCollector struct {
+	service_node_count            *prometheus.Desc
+	service_single_node           *prometheus.Desc
+	colocated_kv_index_n1ql_nodes *prometheus.Desc
+	topology_info                 *prometheus.Desc
+}
+
+func init() {
+	registerCollector("topology", true, newTopologyCollector)
+}
+
+func newTopologyCollector() subCollector {
+	return &topologyCollector{
+		service_node_count: newEmxDesc("service_node_count",
+			"Number of nodes running a service.",
+			[]string{"cluster_uuid", "service"},
+		),
+		service_single_node: newEmxDesc("service_single_node",
+			"The service runs on a single node, a single point of failure 0/1 --> false/true.",
+			[]string{"cluster_uuid", "service"},
+		),
+		colocated_kv_index_n1ql_nodes: newEmxDesc("colocated_kv_index_n1ql_nodes",
+			"Number of nodes running the data, index and query services together.",
+			[]string{"cluster_uuid"},
+		),
+		topology_info: newEmxDesc("topology_info",
+			"Service layout as <services>:<node count> per distinct service set and its mode {homogeneous/mds}, always 1.",
+			[]string{"cluster_uuid", "layout", "mode"},
+		),
+	}
+}
+
+func (collector *topologyCollector) Name() string {
+	return "topology"
+}
+
+func (collector *topologyCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterStatus}
+}
+
+func (collector *topologyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.service_node_count
+	ch <- collector.service_single_node
+	ch <- collector.colocated_kv_index_n1ql_nodes
+	ch <- collector.topology_info
+}
+
+func (collector *topologyCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxClusterStatusStruct cbemxClusterStatusDetails
+	if err := s.get(CBEMXENDPOINT_ClusterStatus, &cbemxClusterStatusStruct); err != nil {
+		return err
+	}
+
+	var (
+		serviceCounts = make(map[string]int)
+		layouts       = make(map[string]int)
+		colocated     int
+	)
+	for _, node := range cbemxClusterStatusStruct.Nodes {
+		var nodeServices = make(map[string]bool)
+		for _, service := range node.Services {
+			serviceCounts[service]++
+			nodeServices[service] = true
+		}
+		if nodeServices["kv"] && nodeServices["index"] && nodeServices["n1ql"] {
+			colocated++
+		}
+		// service sets are keyed in CLUSTER_SERVICES order, e.g. "kv+index+n1ql"
+		var serviceSet []string
+		for _, service := range CLUSTER_SERVICES {
+			if nodeServices[service] {
+				serviceSet = append(serviceSet, service)
+			}
+		}
+		layouts[strings.Join(serviceSet, "+")]++
+	}
+
+	for _, service := range CLUSTER_SERVICES {
+		ch <- prometheus.MustNewConstMetric(collector.service_node_count, prometheus.GaugeValue, float64(serviceCounts[service]), s.uuid, service)
+		if serviceCounts[service] > 0 {
+			ch <- prometheus.MustNewConstMetric(collector.service_single_node, prometheus.GaugeValue, float64(boolVal(serviceCounts[service] == 1)), s.uuid, service)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.colocated_kv_index_n1ql_nodes, prometheus.GaugeValue, float64(colocated), s.uuid)
+
+	var layout []string
+	for serviceSet, count := range layouts {
+		layout = append(layout, fmt.Sprintf("%s:%d", serviceSet, count))
+	}
+	sort.Strings(layout)
+	var mode = "mds"
+	if len(layouts) == 1 {
+		mode = "homogeneous"
+	}
+	ch <- prometheus.MustNewConstMetric(collector.topology_info, prometheus.GaugeValue, 1, s.uuid, strings.Join(layout, ","), mode)
+	return nil
+}
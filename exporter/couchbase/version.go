@@ -0,0 +1,211 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CBEMXENDPOINT_PoolsDefault, cluster and node versions
+type cbemxClusterVersionDetails struct {
+	ClusterCompatibility int `json:"clusterCompatibility"`
+	Nodes                []struct {
+		Hostname string `json:"hostname"`
+		Version  string `json:"version"` // e.g. 7.2.0-5325-enterprise
+	} `json:"nodes"`
+}
+
+// Major and minor version, the zero value stands for an unknown version
+type clusterVersion struct {
+	major int
+	minor int
+}
+
+// clusterCompatibility encodes the version as major * 0x10000 + minor, e.g. 7.1 -> 458753
+func compatibilityVersion(compatibility int) clusterVersion {
+	return clusterVersion{major: compatibility / 0x10000, minor: compatibility % 0x10000}
+}
+
+func (v clusterVersion) atLeast(other clusterVersion) bool {
+	return v.major > other.major || (v.major == other.major && v.minor >= other.minor)
+}
+
+func (v clusterVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// Whether the cluster supports features of the given version, an unknown version supports everything
+func (s *scrape) supports(v clusterVersion) bool {
+	var version = s.effectiveVersion()
+	return version == (clusterVersion{}) || version.atLeast(v)
+}
+
+// Cluster uuid and versions, detected by the first scrape and reused by the following ones
+type detectedCluster struct {
+	uuid          string
+	version       clusterVersion
+	compatibility clusterVersion
+}
+
+var (
+	detectedMu sync.Mutex
+	detected   *detectedCluster
+)
+
+/*
+* The detected cluster, read from /pools and /pools/default when nothing is detected yet.
+* Nothing is kept while either endpoint fails, the next scrape tries again.
+ */
+func detectCluster(s *scrape) detectedCluster {
+	detectedMu.Lock()
+	var cached = detected
+	detectedMu.Unlock()
+	if cached != nil {
+		return *cached
+	}
+
+	var cluster detectedCluster
+	var cbemxClusterUUIDStruct cbemxClusterUUIDDetails
+	uuidErr := s.get(CBEMXENDPOINT_ClusterUUID, &cbemxClusterUUIDStruct)
+	cluster.uuid = cbemxClusterUUIDStruct.UUID
+	cluster.version = parseVersion(cbemxClusterUUIDStruct.ImplementationVersion)
+	var cbemxClusterVersionStruct cbemxClusterVersionDetails
+	versionErr := s.get(CBEMXENDPOINT_PoolsDefault, &cbemxClusterVersionStruct)
+	if versionErr == nil {
+		cluster.compatibility = compatibilityVersion(cbemxClusterVersionStruct.ClusterCompatibility)
+	}
+	if uuidErr == nil && versionErr == nil {
+		level.Info(logger).Log("Event", "Detected cluster "+cluster.uuid+" at version "+cluster.version.String()+", compatibility "+cluster.compatibility.String())
+		detectedMu.Lock()
+		detected = &cluster
+		detectedMu.Unlock()
+	}
+	return cluster
+}
+
+/*
+* Forget the detected cluster when /pools or /pools/default fail or the cluster compatibility
+* read by any collector differs from the detected one, e.g. after an upgrade finished.
+ */
+func checkDetectedCluster(url string, body []byte, err error) {
+	if url != CB_CONNECTIONSTRING+CBEMXENDPOINT_ClusterUUID && url != CB_CONNECTIONSTRING+CBEMXENDPOINT_PoolsDefault {
+		return
+	}
+	detectedMu.Lock()
+	defer detectedMu.Unlock()
+	if detected == nil {
+		return
+	}
+	if err == nil && url == CB_CONNECTIONSTRING+CBEMXENDPOINT_ClusterUUID {
+		return
+	}
+	if err == nil {
+		var cbemxClusterVersionStruct cbemxClusterVersionDetails
+		if json.Unmarshal(body, &cbemxClusterVersionStruct) == nil && compatibilityVersion(cbemxClusterVersionStruct.ClusterCompatibility) == detected.compatibility {
+			return
+		}
+	}
+	level.Info(logger).Log("Event", "Cluster compatibility changed or unavailable, detecting the cluster version again")
+	detected = nil
+}
+
+// Label options for radio select metric streams
+var NODE_EDITIONS = [...]string{"enterprise", "community"}
+
+// Split a node version "7.2.0-5325-enterprise" into "7.2.0-5325" and "enterprise"
+func versionEdition(version string) (string, string) {
+	for _, edition := range NODE_EDITIONS {
+		if strings.HasSuffix(version, "-"+edition) {
+			return strings.TrimSuffix(version, "-"+edition), edition
+		}
+	}
+	return version, ""
+}
+
+// Cluster compatibility and node versions
+type versionCollector struct {
+	cluster_compatibility      *prometheus.Desc
+	cluster_compatibility_info *prometheus.Desc
+	node_version_info          *prometheus.Desc
+	cluster_mixed_version      *prometheus.Desc
+	cluster_version_count      *prometheus.Desc
+	capability                 *prometheus.Desc
+}
+
+func init() {
+	registerCollector("version", true, newVersionCollector)
+}
+
+func newVersionCollector() subCollector {
+	return &versionCollector{
+		cluster_compatibility: newEmxDesc("cluster_compatibility",
+			"The effective cluster compatibility as major * 65536 + minor.",
+			[]string{"cluster_uuid"},
+		),
+		cluster_compatibility_info: newEmxDesc("cluster_compatibility_info",
+			"The effective cluster compatibility version as major.minor, always 1.",
+			[]string{"cluster_uuid", "version"},
+		),
+		node_version_info: newEmxDesc("node_version_info",
+			"The server version and edition {enterprise/community} of a node, always 1.",
+			[]string{"cluster_uuid", "node", "version", "edition"},
+		),
+		cluster_mixed_version: newEmxDesc("cluster_mixed_version",
+			"Nodes run different server versions, e.g. during a rolling upgrade 0/1 --> false/true.",
+			[]string{"cluster_uuid"},
+		),
+		cluster_version_count: newEmxDesc("cluster_version_count",
+			"The number of distinct server versions in the cluster.",
+			[]string{"cluster_uuid"},
+		),
+		capability: newEmxDesc("capability",
+			"A feature EMX checks is available at the cluster version, checks relying on it are skipped otherwise 0/1 --> false/true.",
+			[]string{"cluster_uuid", "name"},
+		),
+	}
+}
+
+func (collector *versionCollector) Name() string {
+	return "version"
+}
+
+func (collector *versionCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_ClusterUUID, CBEMXENDPOINT_PoolsDefault}
+}
+
+func (collector *versionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.cluster_compatibility
+	ch <- collector.cluster_compatibility_info
+	ch <- collector.node_version_info
+	ch <- collector.cluster_mixed_version
+	ch <- collector.cluster_version_count
+	ch <- collector.capability
+}
+
+func (collector *versionCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var cbemxClusterVersionStruct cbemxClusterVersionDetails
+	if err := s.get(CBEMXENDPOINT_PoolsDefault, &cbemxClusterVersionStruct); err != nil {
+		return err
+	}
+	var compatibility = cbemxClusterVersionStruct.ClusterCompatibility
+	ch <- prometheus.MustNewConstMetric(collector.cluster_compatibility, prometheus.GaugeValue, float64(compatibility), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.cluster_compatibility_info, prometheus.GaugeValue, 1, s.uuid, compatibilityVersion(compatibility).String())
+
+	var versions []string
+	for _, node := range cbemxClusterVersionStruct.Nodes {
+		version, edition := versionEdition(node.Version)
+		versions = appendUnique(versions, version)
+		ch <- prometheus.MustNewConstMetric(collector.node_version_info, prometheus.GaugeValue, 1, s.uuid, strings.Split(node.Hostname, ":")[0], version, edition)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.cluster_mixed_version, prometheus.GaugeValue, float64(boolVal(len(versions) > 1)), s.uuid)
+	ch <- prometheus.MustNewConstMetric(collector.cluster_version_count, prometheus.GaugeValue, float64(len(versions)), s.uuid)
+
+	for _, c := range CAPABILITIES {
+		ch <- prometheus.MustNewConstMetric(collector.capability, prometheus.GaugeValue, float64(boolVal(s.has(c.name))), s.uuid, c.name)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package couchbase
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+)
+
+func TestClusterDetectedOnceUntilCompatibilityChanges(t *testing.T) {
+	replayFixtures(t, "version_7_1")
+	if s := newScrape(); s.compatibility != (clusterVersion{7, 1}) {
+		t.Fatalf("detected compatibility %s, expected 7.1", s.compatibility)
+	}
+
+	// the upgrade finished, the next scrape keeps the detected version without asking again
+	switchFixtures("query_nodes")
+	s := newScrape()
+	if s.compatibility != (clusterVersion{7, 1}) {
+		t.Errorf("compatibility %s after detection, expected the detected 7.1", s.compatibility)
+	}
+	if _, requested := s.responses[CB_CONNECTIONSTRING+CBEMXENDPOINT_PoolsDefault]; requested {
+		t.Error("/pools/default requested again after detection")
+	}
+
+	// a collector reading /pools/default sees the new compatibility, the following scrape detects it
+	var cbemxClusterVersionStruct cbemxClusterVersionDetails
+	if err := s.get(CBEMXENDPOINT_PoolsDefault, &cbemxClusterVersionStruct); err != nil {
+		t.Fatal(err)
+	}
+	if s := newScrape(); s.compatibility != (clusterVersion{7, 2}) || s.version != (clusterVersion{7, 2}) {
+		t.Errorf("compatibility %s and version %s after the upgrade, expected 7.2", s.compatibility, s.version)
+	}
+}
+
+func TestClusterDetectedAgainAfterFailure(t *testing.T) {
+	replayFixtures(t, "missing")
+	if s := newScrape(); s.effectiveVersion() != (clusterVersion{}) {
+		t.Fatalf("version %s without a cluster, expected unknown", s.effectiveVersion())
+	}
+	switchFixtures("query_nodes")
+	if s := newScrape(); s.compatibility != (clusterVersion{7, 2}) {
+		t.Errorf("compatibility %s once the cluster answers, expected 7.2", s.compatibility)
+	}
+}
+
+// Replay another scenario keeping the detected cluster, the replay transport reads the directory once
+func switchFixtures(scenario string) {
+	replayDir = filepath.Join("testdata", scenario)
+	cbemxClient = newCbemxHttpClient(tls.Certificate{})
+}
@@ -0,0 +1,190 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Per remote cluster reference from CBEMXENDPOINT_RemoteClusters
+type cbemxRemoteClusterDetails struct {
+	Name             string `json:"name"`
+	UUID             string `json:"uuid"`
+	Deleted          bool   `json:"deleted"`
+	DemandEncryption bool   `json:"demandEncryption"`
+	EncryptionType   string `json:"encryptionType"`
+}
+
+// CBEMXENDPOINT_ReplicationSettings
+type cbemxReplicationSettingsDetails struct {
+	CompressionType  string          `json:"compressionType"`
+	FilterExpression string          `json:"filterExpression"`
+	ConflictLogging  json.RawMessage `json:"conflictLogging"`
+}
+
+// Label options for radio select metric streams
+var XDCR_REPLICATION_STATUS = [...]string{"running", "paused", "error"}
+var XDCR_COMPRESSION_TYPE = [...]string{"None", "Auto", "Snappy"}
+
+// XDCR remote clusters and replications
+type xdcrCollector struct {
+	xdcr_remote_cluster_info           *prometheus.Desc
+	xdcr_replication_status            *prometheus.Desc
+	xdcr_replication_filter_expression *prometheus.Desc
+	xdcr_replication_compression_type  *prometheus.Desc
+	xdcr_replication_conflict_logging  *prometheus.Desc
+	xdcr_replication_error_count       *prometheus.Desc
+}
+
+func init() {
+	registerCollector("xdcr", true, newXdcrCollector)
+}
+
+func newXdcrCollector() subCollector {
+	var replicationLabels = []string{"cluster_uuid", "source_bucket", "remote_cluster", "target_bucket"}
+	return &xdcrCollector{
+		xdcr_remote_cluster_info: newEmxDesc("xdcr_remote_cluster_info",
+			"Remote cluster reference with its encryption type {none/half/full}, always 1.",
+			[]string{"cluster_uuid", "remote_cluster", "remote_uuid", "encryption_type"},
+		),
+		xdcr_replication_status: newEmxDesc("xdcr_replication_status",
+			"The replication status {running/paused/error} selected state(1 - selected).",
+			withLabel(replicationLabels, "status"),
+		),
+		xdcr_replication_filter_expression: newEmxDesc("xdcr_replication_filter_expression",
+			"The replication has a filter expression 0/1 --> false/true.",
+			replicationLabels,
+		),
+		xdcr_replication_compression_type: newEmxDesc("xdcr_replication_compression_type",
+			"The replication compression type {None/Auto/Snappy} selected state(1 - selected).",
+			withLabel(replicationLabels, "compression"),
+		),
+		xdcr_replication_conflict_logging: newEmxDesc("xdcr_replication_conflict_logging",
+			"The replication conflict logging state 0/1 --> disabled/enabled.",
+			replicationLabels,
+		),
+		xdcr_replication_error_count: newEmxDesc("xdcr_replication_error_count",
+			"The number of errors currently reported for the replication.",
+			replicationLabels,
+		),
+	}
+}
+
+func (collector *xdcrCollector) Name() string {
+	return "xdcr"
+}
+
+func (collector *xdcrCollector) Endpoints() []string {
+	return []string{CBEMXENDPOINT_RemoteClusters, CBEMXENDPOINT_Tasks, CBEMXENDPOINT_ReplicationSettings + "<id>"}
+}
+
+func (collector *xdcrCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.xdcr_remote_cluster_info
+	ch <- collector.xdcr_replication_status
+	ch <- collector.xdcr_replication_filter_expression
+	ch <- collector.xdcr_replication_compression_type
+	ch <- collector.xdcr_replication_conflict_logging
+	ch <- collector.xdcr_replication_error_count
+}
+
+// Number of entries of a json array, 0 for anything else
+func jsonArrayLength(raw json.RawMessage) int {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+/*
+* Conflict logging is configured with an object naming the conflict bucket,
+* an empty or missing object or "disabled": true means it is off.
+ */
+func conflictLoggingEnabled(raw json.RawMessage) bool {
+	var settings map[string]interface{}
+	if err := json.Unmarshal(raw, &settings); err != nil || len(settings) == 0 {
+		return false
+	}
+	if disabled, ok := settings["disabled"].(bool); ok && disabled {
+		return false
+	}
+	return true
+}
+
+func (collector *xdcrCollector) Collect(s *scrape, ch chan<- prometheus.Metric) error {
+	var (
+		errs                     []error
+		cbemxRemoteClustersArray []cbemxRemoteClusterDetails
+		cbemxTasksArray          []cbemxTaskDetails
+	)
+
+	var remoteNames = make(map[string]string)
+	if err := s.get(CBEMXENDPOINT_RemoteClusters, &cbemxRemoteClustersArray); err != nil {
+		errs = append(errs, err)
+	}
+	for _, remote := range cbemxRemoteClustersArray {
+		if remote.Deleted {
+			continue
+		}
+		remoteNames[remote.UUID] = remote.Name
+		var encryptionType = "none"
+		if remote.DemandEncryption {
+			encryptionType = remote.EncryptionType
+			if encryptionType == "" {
+				encryptionType = "full"
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(collector.xdcr_remote_cluster_info, prometheus.GaugeValue, 1, s.uuid, remote.Name, remote.UUID, encryptionType)
+	}
+
+	if err := s.get(CBEMXENDPOINT_Tasks, &cbemxTasksArray); err != nil {
+		errs = append(errs, err)
+		return errors.Join(errs...)
+	}
+	for _, task := range cbemxTasksArray {
+		if task.Type != "xdcr" || !s.include("bucket", task.Source) {
+			continue
+		}
+		// target is /remoteClusters/<remote uuid>/buckets/<target bucket>, the labels can't tell other replications apart
+		target := strings.Split(strings.Trim(task.Target, "/"), "/")
+		if len(target) != 4 {
+			level.Warn(logger).Log("Event", "Skipping replication '"+task.Id+"' with unexpected target '"+task.Target+"'")
+			continue
+		}
+		var remoteCluster = remoteNames[target[1]]
+		if remoteCluster == "" {
+			remoteCluster = target[1]
+		}
+		var targetBucket = target[3]
+		var labels = []string{s.uuid, task.Source, remoteCluster, targetBucket}
+
+		var errorCount = jsonArrayLength(task.Errors)
+		var status = "paused"
+		if errorCount > 0 {
+			status = "error"
+		} else if task.Status == "running" {
+			status = "running"
+		}
+		for _, option := range XDCR_REPLICATION_STATUS {
+			ch <- prometheus.MustNewConstMetric(collector.xdcr_replication_status, prometheus.GaugeValue, float64(boolVal(option == status)), withLabel(labels, option)...)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.xdcr_replication_error_count, prometheus.GaugeValue, float64(errorCount), labels...)
+
+		var cbemxReplicationSettingsStruct cbemxReplicationSettingsDetails
+		if err := s.get(CBEMXENDPOINT_ReplicationSettings+url.PathEscape(task.Id), &cbemxReplicationSettingsStruct); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.xdcr_replication_filter_expression, prometheus.GaugeValue, float64(boolVal(cbemxReplicationSettingsStruct.FilterExpression != "")), labels...)
+		for _, option := range XDCR_COMPRESSION_TYPE {
+			ch <- prometheus.MustNewConstMetric(collector.xdcr_replication_compression_type, prometheus.GaugeValue, float64(boolVal(option == cbemxReplicationSettingsStruct.CompressionType)), withLabel(labels, option)...)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.xdcr_replication_conflict_logging, prometheus.GaugeValue, float64(boolVal(conflictLoggingEnabled(cbemxReplicationSettingsStruct.ConflictLogging))), labels...)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,28 @@
+package couchbase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReplicationWithUnexpectedTarget(t *testing.T) {
+	collector := newReplayCollector(t, "xdcr", "xdcr")
+
+	expected := `
+# HELP xdcr_replication_status The replication status {running/paused/error} selected state(1 - selected).
+# TYPE xdcr_replication_status gauge
+xdcr_replication_status{cluster_uuid="00000000000000000000000000000001",remote_cluster="remote-1",source_bucket="bucket-1",status="error",target_bucket="bucket-2"} 0
+xdcr_replication_status{cluster_uuid="00000000000000000000000000000001",remote_cluster="remote-1",source_bucket="bucket-1",status="paused",target_bucket="bucket-2"} 0
+xdcr_replication_status{cluster_uuid="00000000000000000000000000000001",remote_cluster="remote-1",source_bucket="bucket-1",status="running",target_bucket="bucket-2"} 1
+# HELP xdcr_replication_compression_type The replication compression type {None/Auto/Snappy} selected state(1 - selected).
+# TYPE xdcr_replication_compression_type gauge
+xdcr_replication_compression_type{cluster_uuid="00000000000000000000000000000001",compression="Auto",remote_cluster="remote-1",source_bucket="bucket-1",target_bucket="bucket-2"} 1
+xdcr_replication_compression_type{cluster_uuid="00000000000000000000000000000001",compression="None",remote_cluster="remote-1",source_bucket="bucket-1",target_bucket="bucket-2"} 0
+xdcr_replication_compression_type{cluster_uuid="00000000000000000000000000000001",compression="Snappy",remote_cluster="remote-1",source_bucket="bucket-1",target_bucket="bucket-2"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "xdcr_replication_status", "xdcr_replication_compression_type"); err != nil {
+		t.Error(err)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"os"
 
 	"github.com/go-kit/kit/log/level"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const EMX_PORT = "9876"
@@ -23,6 +22,23 @@ func main() {
 
 	disableTLS := flag.Bool("disableTLS", false, "Include if TLS is to be disabled, will default to false enabling HTTPS only mode")
 
+	namespace := flag.String("namespace", "couchbase_emx", "Prefix for all metric names, empty for no prefix")
+	constLabels := flag.String("constLabels", "", "Comma separated name=value labels added to every series, e.g. cluster_name=prod1,environment=production")
+
+	fixtureDir := flag.String("fixtureDir", "fixtures", "Directory redacted cluster responses are written to in record mode")
+	replayDir := flag.String("replayDir", "", "Directory of recorded fixtures to serve metrics from instead of a live cluster")
+
+	// 'couchbase_emx record [flags]' records fixtures instead of serving metrics
+	var record = len(os.Args) > 1 && os.Args[1] == "record"
+	if record {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	// --collector.<name> / --no-collector.<name> for each sub-collector
+	couchbase.RegisterCollectorFlags()
+	// --filter.<bucket|scope|collection|index>.<include|exclude> and series limit
+	couchbase.RegisterFilterFlags()
+
 	var tlsConfig utility.TLSConfig
 
 	flag.Parse()
@@ -31,8 +47,46 @@ func main() {
 
 	// Instantiating the logger object
 	logger := utility.Logger()
+
+	var metricNamespace = *namespace
+	if envNamespace, ok := os.LookupEnv("EMX_NAMESPACE"); ok {
+		metricNamespace = envNamespace
+	}
+	var metricLabels = os.Getenv("EMX_CONST_LABELS")
+	if metricLabels == "" {
+		metricLabels = *constLabels
+	}
+	if err := couchbase.ConfigureMetrics(metricNamespace, metricLabels); err != nil {
+		level.Error(logger).Log("Error", err)
+		os.Exit(1)
+	}
+	if err := couchbase.ConfigureFilters(); err != nil {
+		level.Error(logger).Log("Error", err)
+		os.Exit(1)
+	}
+
+	if record {
+		if err := couchbase.EnableRecording(*fixtureDir); err != nil {
+			level.Error(logger).Log("Error - failed to create fixture directory", err)
+			os.Exit(1)
+		}
+	} else if *replayDir != "" {
+		if err := couchbase.EnableReplay(*replayDir); err != nil {
+			level.Error(logger).Log("Error - failed to open fixture directory", err)
+			os.Exit(1)
+		}
+	}
+
 	// Triggering the couchbase emx stats metrics creation
 	couchbase.CreateCouchbaseEMXStatsMetrics(logger, tlsConfig)
+
+	if record {
+		if err := couchbase.RecordFixtures(logger); err != nil {
+			level.Error(logger).Log("Error - failed to record fixtures", err)
+			os.Exit(1)
+		}
+		return
+	}
 	var port string = ""
 	port = os.Getenv("EMX_PORT")
 	if port == "" {
@@ -54,9 +108,11 @@ func main() {
 			level.Error(logger).Log("Error", "TLS enabled but no CERT or KEY file declared.")
 			os.Exit(1)
 		}
+		couchbase.SetServerCertificate(tlsCert)
 
 		level.Info(logger).Log("Event", "Exposing metrics at the endpoint '/metrics' on port '"+port+"'.")
-		http.Handle("/metrics", promhttp.Handler())
+		http.Handle("/metrics", couchbase.MetricsHandler())
+		http.Handle("/rebalance-report", couchbase.RebalanceReportHandler())
 		err := http.ListenAndServeTLS(":"+EMX_PORT, tlsCert, tlsKey, nil)
 		if err != nil {
 			level.Error(logger).Log("Error - failed to start HTTPS server", err)
@@ -67,7 +123,8 @@ func main() {
 		level.Info(logger).Log("Event", "TLS Disabled")
 
 		level.Info(logger).Log("Event", "Exposing metrics at the endpoint '/metrics' on port '"+port+"'.")
-		http.Handle("/metrics", promhttp.Handler())
+		http.Handle("/metrics", couchbase.MetricsHandler())
+		http.Handle("/rebalance-report", couchbase.RebalanceReportHandler())
 		err := http.ListenAndServe(":"+port, nil)
 		if err != nil {
 			level.Error(logger).Log("Error - failed to start HTTP server", err)